@@ -0,0 +1,96 @@
+/*
+Copyright 2024 The KubeStellar Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// AggregatedWorkStatus combines the WorkStatuses reported by all clusters for the same source object
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:scope=Cluster,shortName={agws}
+// +kubebuilder:printcolumn:name="Kind",type=string,JSONPath=`.spec.sourceRef.kind`
+// +kubebuilder:printcolumn:name="Namespace",type=string,JSONPath=`.spec.sourceRef.namespace`
+// +kubebuilder:printcolumn:name="Name",type=string,JSONPath=`.spec.sourceRef.name`
+// +kubebuilder:printcolumn:name="Ready",type=integer,JSONPath=`.status.readyClusters`
+// +kubebuilder:printcolumn:name="Reported",type=integer,JSONPath=`.status.reportedClusters`
+// +kubebuilder:printcolumn:name="Expected",type=integer,JSONPath=`.status.expectedClusters`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+type AggregatedWorkStatus struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   AggregatedWorkStatusSpec   `json:"spec,omitempty"`
+	Status AggregatedWorkStatusStatus `json:"status,omitempty"`
+}
+
+// AggregatedWorkStatusSpec identifies the source object
+type AggregatedWorkStatusSpec struct {
+	SourceRef SourceRef `json:"sourceRef"`
+}
+
+// AggregatedWorkStatusStatus summarizes the statuses reported for the source object
+type AggregatedWorkStatusStatus struct {
+	// `expectedClusters` is the number of clusters with a ManifestWork that includes the source object
+	ExpectedClusters int32 `json:"expectedClusters"`
+	// `reportedClusters` is the number of clusters with a WorkStatus for the source object
+	ReportedClusters int32 `json:"reportedClusters"`
+	// `readyClusters` is the number of clusters reporting the source object as ready
+	ReadyClusters int32 `json:"readyClusters"`
+	// `oldestReportTime` is the time of the least recent status report among the clusters
+	// +optional
+	OldestReportTime *metav1.Time `json:"oldestReportTime,omitempty"`
+	// `newestReportTime` is the time of the most recent status report among the clusters
+	// +optional
+	NewestReportTime *metav1.Time `json:"newestReportTime,omitempty"`
+	// `missingClusters` lists the clusters expected to report but with no WorkStatus
+	// +optional
+	MissingClusters []string `json:"missingClusters,omitempty"`
+	// `clusters` lists the status reported by each cluster, sorted by cluster name
+	// +optional
+	Clusters []ClusterWorkStatus `json:"clusters,omitempty"`
+}
+
+// ClusterWorkStatus summarizes the WorkStatus reported by a cluster
+type ClusterWorkStatus struct {
+	// `cluster` is the name of the cluster, that is the namespace of the WorkStatus
+	Cluster string `json:"cluster"`
+	// `workStatusName` is the name of the WorkStatus
+	WorkStatusName string `json:"workStatusName"`
+	// `ready` indicates whether the status reports the source object as ready
+	Ready bool `json:"ready"`
+	// `lastGeneration` is copied from the status details of the WorkStatus
+	LastGeneration int64 `json:"lastGeneration"`
+	// `lastGenerationIsApplied` is copied from the status details of the WorkStatus
+	LastGenerationIsApplied bool `json:"lastGenerationIsApplied"`
+	// `lastReportTime` is the time of the last update of the status of the WorkStatus
+	// +optional
+	LastReportTime *metav1.Time `json:"lastReportTime,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// AggregatedWorkStatusList contains a list of AggregatedWorkStatus
+type AggregatedWorkStatusList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []AggregatedWorkStatus `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&AggregatedWorkStatus{}, &AggregatedWorkStatusList{})
+}
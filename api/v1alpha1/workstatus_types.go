@@ -25,6 +25,13 @@ import (
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
 // +kubebuilder:resource:scope=Namespaced,shortName={ws,wss}
+// +kubebuilder:printcolumn:name="Kind",type=string,JSONPath=`.spec.sourceRef.kind`
+// +kubebuilder:printcolumn:name="Source Namespace",type=string,JSONPath=`.spec.sourceRef.namespace`
+// +kubebuilder:printcolumn:name="Source Name",type=string,JSONPath=`.spec.sourceRef.name`
+// +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.health.phase`
+// +kubebuilder:printcolumn:name="Generation",type=integer,JSONPath=`.statusDetails.lastGeneration`
+// +kubebuilder:printcolumn:name="Applied",type=boolean,JSONPath=`.statusDetails.lastGenerationIsApplied`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 type WorkStatus struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
@@ -32,8 +39,30 @@ type WorkStatus struct {
 	Spec          WorkStatusSpec `json:"spec,omitempty"`
 	Status        RawStatus      `json:"status,omitempty"`
 	StatusDetails StatusDetails  `json:"statusDetails,omitempty"`
+	// `health` is the health assessed by the agent for the common kinds.
+	// It is not set for other kinds.
+	// +optional
+	Health *Health `json:"health,omitempty"`
+	// `redactedFields` is the number of values removed or hashed by the agent
+	// in the reported status, as they may be sensitive
+	// +optional
+	RedactedFields int32 `json:"redactedFields,omitempty"`
+	// `truncation` is set when the status of the object exceeded the size budget
+	// of the agent, and records how the reported status was shrunk.
+	// +optional
+	Truncation *StatusTruncation `json:"truncation,omitempty"`
+	// `conditions` holds the ReportingFailed condition, set by the agent when it
+	// persistently fails to report the status of the object
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
+// WorkStatusConditionReportingFailed means that the agent fails to report the status of the object,
+// the reported status being stale
+const WorkStatusConditionReportingFailed = "ReportingFailed"
+
 // Workstatus spec
 type WorkStatusSpec struct {
 	SourceRef SourceRef `json:"sourceRef,omitempty"`
@@ -55,6 +84,63 @@ type StatusDetails struct {
 	LastCurrencyUpdateTime metav1.Time `json:"lastCurrencyUpdateTime"`
 }
 
+// HealthPhase summarizes the health of an object
+// +kubebuilder:validation:Enum=Healthy;Progressing;Degraded;Unknown
+type HealthPhase string
+
+const (
+	HealthPhaseHealthy     HealthPhase = "Healthy"
+	HealthPhaseProgressing HealthPhase = "Progressing"
+	HealthPhaseDegraded    HealthPhase = "Degraded"
+	HealthPhaseUnknown     HealthPhase = "Unknown"
+)
+
+// Types of the health conditions
+const (
+	// HealthConditionAvailable means that the object serves its purpose, e.g. enough replicas are available
+	HealthConditionAvailable = "Available"
+	// HealthConditionProgressing means that the object is moving towards its desired state
+	HealthConditionProgressing = "Progressing"
+	// HealthConditionDegraded means that the object failed to reach or keep its desired state
+	HealthConditionDegraded = "Degraded"
+)
+
+// Health is the health of an object, computed in the same way for all clusters
+type Health struct {
+	// `phase` is Degraded when the Degraded condition is true, otherwise Progressing when
+	// the Progressing condition is true, otherwise Healthy when the Available condition is true,
+	// and Unknown otherwise
+	Phase HealthPhase `json:"phase"`
+	// `conditions` holds the Available, Progressing and Degraded conditions
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// StatusEncodingGzip is the encoding of a status compressed with gzip, whose base64 encoding
+// is held in the `compressed` field of the status
+const StatusEncodingGzip = "gzip"
+
+// StatusTruncation records how a status exceeding the size budget of the agent was shrunk.
+// The steps are applied in order until the status fits: the projection for oversized statuses,
+// the removal of the largest lists other than the conditions, the compression, and finally
+// the removal of all fields other than the conditions.
+type StatusTruncation struct {
+	// `originalSize` is the size in bytes of the JSON encoding of the status before shrinking it
+	OriginalSize int64 `json:"originalSize"`
+	// `projected` is true when the projection for oversized statuses of the kind was applied
+	// +optional
+	Projected bool `json:"projected,omitempty"`
+	// `droppedFields` are the paths of the fields removed from the status, e.g. `.status.items`
+	// +optional
+	DroppedFields []string `json:"droppedFields,omitempty"`
+	// `encoding` is `gzip` when the status is compressed, in which case the status holds the
+	// conditions and the base64 encoding of the compressed status in the `compressed` field
+	// +optional
+	Encoding string `json:"encoding,omitempty"`
+}
+
 // +kubebuilder:object:root=true
 // WorkStatusList contains a list of WorkStatus
 type WorkStatusList struct {
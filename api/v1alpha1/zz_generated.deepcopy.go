@@ -21,9 +21,161 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AggregatedWorkStatus) DeepCopyInto(out *AggregatedWorkStatus) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	out.Spec = in.Spec
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AggregatedWorkStatus.
+func (in *AggregatedWorkStatus) DeepCopy() *AggregatedWorkStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(AggregatedWorkStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *AggregatedWorkStatus) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AggregatedWorkStatusList) DeepCopyInto(out *AggregatedWorkStatusList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]AggregatedWorkStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AggregatedWorkStatusList.
+func (in *AggregatedWorkStatusList) DeepCopy() *AggregatedWorkStatusList {
+	if in == nil {
+		return nil
+	}
+	out := new(AggregatedWorkStatusList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *AggregatedWorkStatusList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AggregatedWorkStatusSpec) DeepCopyInto(out *AggregatedWorkStatusSpec) {
+	*out = *in
+	out.SourceRef = in.SourceRef
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AggregatedWorkStatusSpec.
+func (in *AggregatedWorkStatusSpec) DeepCopy() *AggregatedWorkStatusSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(AggregatedWorkStatusSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AggregatedWorkStatusStatus) DeepCopyInto(out *AggregatedWorkStatusStatus) {
+	*out = *in
+	if in.OldestReportTime != nil {
+		in, out := &in.OldestReportTime, &out.OldestReportTime
+		*out = (*in).DeepCopy()
+	}
+	if in.NewestReportTime != nil {
+		in, out := &in.NewestReportTime, &out.NewestReportTime
+		*out = (*in).DeepCopy()
+	}
+	if in.MissingClusters != nil {
+		in, out := &in.MissingClusters, &out.MissingClusters
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Clusters != nil {
+		in, out := &in.Clusters, &out.Clusters
+		*out = make([]ClusterWorkStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AggregatedWorkStatusStatus.
+func (in *AggregatedWorkStatusStatus) DeepCopy() *AggregatedWorkStatusStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(AggregatedWorkStatusStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterWorkStatus) DeepCopyInto(out *ClusterWorkStatus) {
+	*out = *in
+	if in.LastReportTime != nil {
+		in, out := &in.LastReportTime, &out.LastReportTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterWorkStatus.
+func (in *ClusterWorkStatus) DeepCopy() *ClusterWorkStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterWorkStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Health) DeepCopyInto(out *Health) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Health.
+func (in *Health) DeepCopy() *Health {
+	if in == nil {
+		return nil
+	}
+	out := new(Health)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *RawStatus) DeepCopyInto(out *RawStatus) {
 	*out = *in
@@ -71,6 +223,26 @@ func (in *StatusDetails) DeepCopy() *StatusDetails {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StatusTruncation) DeepCopyInto(out *StatusTruncation) {
+	*out = *in
+	if in.DroppedFields != nil {
+		in, out := &in.DroppedFields, &out.DroppedFields
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StatusTruncation.
+func (in *StatusTruncation) DeepCopy() *StatusTruncation {
+	if in == nil {
+		return nil
+	}
+	out := new(StatusTruncation)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *WorkStatus) DeepCopyInto(out *WorkStatus) {
 	*out = *in
@@ -79,6 +251,23 @@ func (in *WorkStatus) DeepCopyInto(out *WorkStatus) {
 	out.Spec = in.Spec
 	in.Status.DeepCopyInto(&out.Status)
 	in.StatusDetails.DeepCopyInto(&out.StatusDetails)
+	if in.Health != nil {
+		in, out := &in.Health, &out.Health
+		*out = new(Health)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Truncation != nil {
+		in, out := &in.Truncation, &out.Truncation
+		*out = new(StatusTruncation)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WorkStatus.
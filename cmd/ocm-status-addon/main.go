@@ -27,8 +27,11 @@ import (
 	clusterv1 "open-cluster-management.io/api/cluster/v1"
 
 	"github.com/kubestellar/ocm-status-addon/pkg/agent"
+	"github.com/kubestellar/ocm-status-addon/pkg/aggregation"
 	"github.com/kubestellar/ocm-status-addon/pkg/controller"
+	"github.com/kubestellar/ocm-status-addon/pkg/diagnose"
 	"github.com/kubestellar/ocm-status-addon/pkg/observability"
+	"github.com/kubestellar/ocm-status-addon/pkg/rbac"
 )
 
 func main() {
@@ -78,6 +81,7 @@ func newCommand(logConfig *logs.LoggingConfiguration, features featuregate.Featu
 
 	cmd.AddCommand(newControllerCommand())
 	cmd.AddCommand(agent.NewAgentCommand("status"))
+	cmd.AddCommand(diagnose.NewCommand())
 
 	return cmd
 }
@@ -85,6 +89,10 @@ func newCommand(logConfig *logs.LoggingConfiguration, features featuregate.Featu
 type agentController struct {
 	ObservabilityOptions observability.ObservabilityOptions[*pflag.FlagSet]
 	NameToWrapped        map[string]*pflag.Flag
+	EnableAggregation    bool
+	// AgentUserOptions shares its values with the propagated agent flags,
+	// so that the hub controllers select the same ManifestWorks as the agents
+	AgentUserOptions *agent.AgentUserOptions
 }
 
 func newControllerCommand() *cobra.Command {
@@ -97,9 +105,11 @@ func newControllerCommand() *cobra.Command {
 		NameToWrapped: make(map[string]*pflag.Flag)}
 	agentLogConfig := logs.NewLoggingConfiguration()
 	agentUserOptions := agent.NewAgentUserOptions()
+	ac.AgentUserOptions = &agentUserOptions
 	flagsOnAgent := pflag.NewFlagSet("on-agent", pflag.ContinueOnError)
 	flagsFromAgent := pflag.NewFlagSet("from-agent", pflag.ContinueOnError)
 	agentObservability.AddToFlagSet(flagsOnAgent)
+	agentObservability.AddTracingToFlagSet(flagsOnAgent)
 	logs.AddFlags(agentLogConfig, flagsOnAgent)
 	agentUserOptions.AddToFlagSet(flagsFromAgent)
 	cmd := cmdfactory.
@@ -108,6 +118,8 @@ func newControllerCommand() *cobra.Command {
 	cmd.Use = "controller"
 	cmd.Short = "Start the addon controller"
 	ac.ObservabilityOptions.AddToFlagSet(cmd.PersistentFlags())
+	cmd.PersistentFlags().BoolVar(&ac.EnableAggregation, "enable-aggregation", false,
+		"Enable the controller that aggregates the WorkStatuses of all clusters into an AggregatedWorkStatus per source object")
 	for connector, flagSet := range map[string]*pflag.FlagSet{"on": flagsOnAgent, "from": flagsFromAgent} {
 		flagSet.VisitAll(func(flag *pflag.Flag) {
 			wrapped := *flag
@@ -188,6 +200,37 @@ func (ac *agentController) runController(ctx context.Context, kubeConfig *rest.C
 	if err != nil {
 		klog.Fatal(err)
 	}
+
+	selector, err := ac.AgentUserOptions.ManifestWorkSelector()
+	if err != nil {
+		klog.Errorf("invalid ManifestWork selection %v", err)
+		return err
+	}
+	trackingRules, err := ac.AgentUserOptions.TrackingRules()
+	if err != nil {
+		klog.Errorf("invalid agent tracking rules %v", err)
+		return err
+	}
+	hubMgr, err := controller.NewHubManager(kubeConfig)
+	if err != nil {
+		klog.Errorf("failed to create the hub manager %v", err)
+		return err
+	}
+	if err := rbac.NewTrackedKindsReconciler(hubMgr.GetClient(), hubMgr.GetAPIReader(), controller.AddonName, selector, trackingRules).SetupWithManager(hubMgr); err != nil {
+		klog.Errorf("failed to set up the tracked kinds rbac controller %v", err)
+		return err
+	}
+	if ac.EnableAggregation {
+		if err := aggregation.NewReconciler(hubMgr.GetClient(), selector).SetupWithManager(hubMgr); err != nil {
+			klog.Errorf("failed to set up the aggregation controller %v", err)
+			return err
+		}
+	}
+	go func() {
+		if err := hubMgr.Start(ctx); err != nil {
+			klog.Fatal(err)
+		}
+	}()
 	<-ctx.Done()
 
 	return nil
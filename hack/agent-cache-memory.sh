@@ -0,0 +1,35 @@
+#!/usr/bin/env bash
+# Copyright 2024 The KubeStellar Authors.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+# Measures the memory of an informer of the agent caching Pods, without transforms, with the transforms
+# and with a metadata-only informer, each in its own process. The numbers of Pods applied by an
+# AppliedManifestWork and of other Pods can be set with AGENT_CACHE_MEMORY_APPLIED and
+# AGENT_CACHE_MEMORY_OTHER.
+
+set -e # exit on error
+
+SCRIPT_HOME=$(dirname $0)
+TEST_BINARY=$(mktemp)
+trap "rm -f ${TEST_BINARY}" EXIT
+
+(cd ${SCRIPT_HOME}/.. && go test -c -o ${TEST_BINARY} ./pkg/agent)
+
+printf "%-15s %8s %8s %16s %10s\n" setting objects applied heap_inuse_MiB rss_MiB
+for setting in baseline transforms metadata-only; do
+    AGENT_CACHE_MEMORY=${setting} ${TEST_BINARY} -test.run '^TestInformerCacheMemory$' | grep '^setting=' | \
+        awk '{ for (i = 1; i <= NF; i++) { split($i, kv, "="); v[kv[1]] = kv[2] }
+               printf "%-15s %8d %8d %16.1f %10.1f\n", v["setting"], v["objects"], v["applied"],
+                   v["heap_inuse_bytes"] / 1048576, v["rss_bytes"] / 1048576 }'
+done
@@ -3,42 +3,46 @@ package agent
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/time/rate"
 
+	"k8s.io/apimachinery/pkg/api/equality"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
-	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/dynamic/dynamicinformer"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/metadata"
 	"k8s.io/client-go/rest"
-	"k8s.io/client-go/restmapper"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/workqueue"
+	workclientset "open-cluster-management.io/api/client/work/clientset/versioned"
+	workinformers "open-cluster-management.io/api/client/work/informers/externalversions"
+	worklisters "open-cluster-management.io/api/client/work/listers/work/v1"
+	workv1 "open-cluster-management.io/api/work/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	ctrlm "sigs.k8s.io/controller-runtime/pkg/manager"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
 
+	"github.com/kubestellar/ocm-status-addon/pkg/mapping"
 	"github.com/kubestellar/ocm-status-addon/pkg/ocm"
+	"github.com/kubestellar/ocm-status-addon/pkg/projection"
+	"github.com/kubestellar/ocm-status-addon/pkg/redaction"
+	"github.com/kubestellar/ocm-status-addon/pkg/tracking"
 	"github.com/kubestellar/ocm-status-addon/pkg/util"
 )
 
-// generally all resources not creating a status should be excluded
-var excludedGVKs = map[string]bool{
-	"rbac.authorization.k8s.io/v1, Kind=ClusterRoleBinding": true,
-	"rbac.authorization.k8s.io/v1, Kind=ClusterRole":        true,
-	"rbac.authorization.k8s.io/v1, Kind=Role":               true,
-	"rbac.authorization.k8s.io/v1, Kind=RoleBinding":        true,
-	"/v1, Kind=Secret":         true,
-	"/v1, Kind=ConfigMap":      true,
-	"/v1, Kind=ServiceAccount": true,
-}
-
 // Agent tracks objects applied by the work agent by watching
 // AppliedManifestWork* objects. These objects list the GVR, name
 // and namespace (the latter for namespaced objects) of each object applied
@@ -50,31 +54,73 @@ var excludedGVKs = map[string]bool{
 // A `WorkStatus` object contains status for exactly one object, so that
 // status updates for one object do not require updates of a whole bundle.
 type Agent struct {
-	agentName               string
-	clusterName             string
-	ctx                     context.Context
-	logger                  logr.Logger
-	managedDynamicClient    *dynamic.DynamicClient
-	managedKubernetesClient *kubernetes.Clientset
-	managedDynamicFactory   dynamicinformer.DynamicSharedInformerFactory
-	restMapper              meta.RESTMapper
-	hubClient               client.Client
-	listers                 *util.SafeMap
-	informers               *util.SafeMap
-	trackedAppliedManifests util.SafeMap
-	objectsCount            util.SafeUIDMap
-	stoppers                util.SafeMap
-	workqueue               workqueue.RateLimitingInterface
-	initializedTs           time.Time
+	agentName                string
+	clusterName              string
+	ctx                      context.Context
+	logger                   logr.Logger
+	managedDynamicClient     *dynamic.DynamicClient
+	managedKubernetesClient  *kubernetes.Clientset
+	managedDynamicFactory    dynamicinformer.DynamicSharedInformerFactory
+	managedMetadataClient    metadata.Interface
+	restMapper               *mapping.RESTMapper
+	hubClient                client.Client
+	hubHash                  string
+	hubWorkInformerFactory   workinformers.SharedInformerFactory
+	manifestWorkLister       worklisters.ManifestWorkLister
+	listers                  *util.SafeMap
+	informers                *util.SafeMap
+	trackedAppliedManifests  util.SafeMap
+	otherHubAppliedWorks     util.SafeMap
+	objectsCount             util.SafeUIDMap
+	forbiddenKinds           *forbiddenKinds
+	hubContact               *hubContact
+	stoppers                 util.SafeMap
+	writtenStatuses          util.SafeMap
+	reportedObjects          util.SafeMap
+	lastErrors               util.SafeMap
+	traceContexts            util.SafeMap
+	reportingFailures        util.SafeMap
+	eventBroadcaster         record.EventBroadcaster
+	eventRecorder            record.EventRecorder
+	antiEntropyPeriod        time.Duration
+	flagTrackingRules        tracking.Rules
+	metadataOnlyRules        []tracking.Rule
+	cacheTransforms          bool
+	manifestWorkSelector     tracking.ManifestWorkSelector
+	manifestWorkEligibility  util.SafeMap
+	reportIntervals          reportIntervals
+	trackingRules            atomic.Pointer[tracking.Rules]
+	trackingRulesFile        string
+	trackingRulesFileData    []byte
+	statusProjector          atomic.Pointer[projection.Projector]
+	statusProjectionFile     string
+	statusProjectionFileData []byte
+	statusRedactor           atomic.Pointer[redaction.Redactor]
+	statusRedactionFile      string
+	statusRedactionFileData  []byte
+	redactionKeys            []string
+	redactionSalt            []byte
+	maxStatusSize            int
+	compressOversizedStatus  bool
+	workqueue                *fairQueue
+	initializedTs            time.Time
 }
 
 // Create a new agent controller
-func NewAgent(mgr ctrlm.Manager, managedRestConfig *rest.Config, hubRestConfig *rest.Config, clusterName, agentName string) (*Agent, error) {
+func NewAgent(mgr ctrlm.Manager, managedRestConfig *rest.Config, hubRestConfig *rest.Config, clusterName, agentName string,
+	userOptions AgentUserOptions) (*Agent, error) {
 	ratelimiter := workqueue.NewMaxOfRateLimiter(
 		workqueue.NewItemExponentialFailureRateLimiter(5*time.Millisecond, 1000*time.Second),
 		&workqueue.BucketRateLimiter{Limiter: rate.NewLimiter(rate.Limit(50), 300)},
 	)
 
+	// count and trace the requests to the hub
+	contact := &hubContact{}
+	hubRestConfig = rest.CopyConfig(hubRestConfig)
+	hubRestConfig.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+		return hubRequestsRoundTripper{delegate: newHubTracingRoundTripper(rt), contact: contact}
+	})
+
 	managedDynamicClient, err := dynamic.NewForConfig(managedRestConfig)
 	if err != nil {
 		return nil, err
@@ -85,18 +131,73 @@ func NewAgent(mgr ctrlm.Manager, managedRestConfig *rest.Config, hubRestConfig *
 		return nil, err
 	}
 
+	hubWorkClient, err := workclientset.NewForConfig(hubRestConfig)
+	if err != nil {
+		return nil, err
+	}
+
 	managedKubernetesClient, err := kubernetes.NewForConfig(managedRestConfig)
 	if err != nil {
 		return nil, err
 	}
 
+	hubKubernetesClient, err := kubernetes.NewForConfig(hubRestConfig)
+	if err != nil {
+		return nil, err
+	}
+	eventBroadcaster, eventRecorder := newEventBroadcaster(hubKubernetesClient, clusterName)
+
 	managedDynamicFactory := dynamicinformer.NewDynamicSharedInformerFactory(managedDynamicClient, 0*time.Minute)
 
-	restMapper, err := getRestMapper(managedKubernetesClient)
+	// the agent only has access to the ManifestWorks in the cluster namespace on the hub
+	hubWorkInformerFactory := workinformers.NewSharedInformerFactoryWithOptions(hubWorkClient, 0*time.Minute,
+		workinformers.WithNamespace(clusterName))
+
+	managedMetadataClient, err := metadata.NewForConfig(managedRestConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	restMapper, err := mapping.NewRESTMapper(managedKubernetesClient.Discovery())
 	if err != nil {
 		return nil, err
 	}
 
+	flagTrackingRules, err := userOptions.TrackingRules()
+	if err != nil {
+		return nil, err
+	}
+	metadataOnly, err := tracking.ParseRules(userOptions.MetadataOnlyKinds)
+	if err != nil {
+		return nil, err
+	}
+	manifestWorkSelector, err := userOptions.ManifestWorkSelector()
+	if err != nil {
+		return nil, err
+	}
+
+	// the AppliedManifestWorks of other hubs the cluster is registered with are ignored
+	hubHash := userOptions.HubHash
+	if hubHash == "" {
+		hubHash = ocm.HubHash(hubRestConfig.Host)
+	}
+
+	reportIntervals, err := parseReportIntervals(userOptions.MinReportInterval, userOptions.MinReportIntervalOverrides)
+	if err != nil {
+		return nil, err
+	}
+	redactionKeys, err := redaction.ParseKeys(userOptions.RedactionKeys)
+	if err != nil {
+		return nil, err
+	}
+	redactionSalt, err := readRedactionSalt(userOptions.RedactionSaltFile)
+	if err != nil {
+		return nil, err
+	}
+	if len(redactionSalt) == 0 {
+		mgr.GetLogger().Info("No redaction salt, the values to hash are removed instead", "file", userOptions.RedactionSaltFile)
+	}
+
 	agent := &Agent{
 		agentName:               agentName,
 		clusterName:             clusterName,
@@ -105,13 +206,61 @@ func NewAgent(mgr ctrlm.Manager, managedRestConfig *rest.Config, hubRestConfig *
 		managedKubernetesClient: managedKubernetesClient,
 		managedDynamicFactory:   managedDynamicFactory,
 		hubClient:               *hubClient,
+		hubHash:                 hubHash,
+		hubWorkInformerFactory:  hubWorkInformerFactory,
+		managedMetadataClient:   managedMetadataClient,
 		restMapper:              restMapper,
 		listers:                 util.NewSafeMap(),
 		informers:               util.NewSafeMap(),
 		trackedAppliedManifests: *util.NewSafeMap(),
+		otherHubAppliedWorks:    *util.NewSafeMap(),
 		objectsCount:            *util.NewSafeUIDMap(),
+		forbiddenKinds:          newForbiddenKinds(),
+		hubContact:              contact,
 		stoppers:                *util.NewSafeMap(),
-		workqueue:               workqueue.NewRateLimitingQueue(ratelimiter),
+		writtenStatuses:         *util.NewSafeMap(),
+		reportedObjects:         *util.NewSafeMap(),
+		lastErrors:              *util.NewSafeMap(),
+		traceContexts:           *util.NewSafeMap(),
+		reportingFailures:       *util.NewSafeMap(),
+		eventBroadcaster:        eventBroadcaster,
+		eventRecorder:           eventRecorder,
+		antiEntropyPeriod:       userOptions.AntiEntropyPeriod,
+		flagTrackingRules:       flagTrackingRules,
+		metadataOnlyRules:       metadataOnly,
+		cacheTransforms:         userOptions.CacheTransforms,
+		manifestWorkSelector:    manifestWorkSelector,
+		manifestWorkEligibility: *util.NewSafeMap(),
+		reportIntervals:         reportIntervals,
+		trackingRulesFile:       userOptions.TrackingRulesFile,
+		statusProjectionFile:    userOptions.StatusProjectionFile,
+		statusRedactionFile:     userOptions.StatusRedactionFile,
+		redactionKeys:           redactionKeys,
+		redactionSalt:           redactionSalt,
+		maxStatusSize:           userOptions.MaxStatusSize,
+		compressOversizedStatus: userOptions.CompressOversizedStatus,
+	}
+	agent.workqueue = newFairQueue(ratelimiter, agent.queueClassOf, queueFlowOf)
+
+	if err := ctrlmetrics.Registry.Register(trackingCollector{agent: agent}); err != nil {
+		return nil, err
+	}
+
+	agent.trackingRules.Store(&agent.flagTrackingRules)
+	if _, err := agent.loadTrackingRules(); err != nil {
+		return nil, err
+	}
+	agent.statusProjector.Store(&projection.Projector{})
+	if _, err := agent.loadStatusProjection(); err != nil {
+		return nil, err
+	}
+	redactor, err := redaction.NewRedactor(redactionKeys, redaction.Config{}, redactionSalt)
+	if err != nil {
+		return nil, err
+	}
+	agent.statusRedactor.Store(redactor)
+	if _, err := agent.loadStatusRedaction(); err != nil {
+		return nil, err
 	}
 
 	return agent, nil
@@ -141,6 +290,7 @@ func (a *Agent) Start(workers int) error {
 // Invoked by Start() to run the agent
 func (a *Agent) run(workers int) error {
 	defer a.workqueue.ShutDown()
+	defer a.eventBroadcaster.Shutdown()
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -148,24 +298,36 @@ func (a *Agent) run(workers int) error {
 	// start only informer for appliedmanifestwork
 	stopper := make(chan struct{})
 	defer close(stopper)
+	a.restMapper.RunInvalidation(a.managedMetadataClient, stopper)
 	a.startAppliedManifestWorkInformer(stopper)
+	manifestWorkSynced := a.startManifestWorkInformer(stopper)
 
 	// wait for all informers caches to be synced
 	a.logger.Info("Waiting for caches to sync")
-	for _, informerIntf := range a.informers.ListValues() {
-		informer := informerIntf.(cache.SharedIndexInformer)
-		if ok := cache.WaitForCacheSync(ctx.Done(), (informer).HasSynced); !ok {
-			return fmt.Errorf("failed to wait for caches to sync")
-		}
+	if ok := cache.WaitForCacheSync(ctx.Done(), manifestWorkSynced); !ok {
+		return fmt.Errorf("failed to wait for caches to sync")
+	}
+	if err := a.waitForInformersSynced(ctx); err != nil {
+		return fmt.Errorf("failed to wait for caches to sync")
 	}
 	a.logger.Info("All caches synced")
 
+	// avoid rewriting the workstatuses that are already up to date on the hub
+	if err := a.seedWrittenStatuses(ctx); err != nil {
+		a.logger.Error(err, "could not list workstatuses on hub, all workstatuses will be rewritten")
+	}
+
 	a.logger.Info("Starting workers", "count", workers)
 	for i := 0; i < workers; i++ {
 		go wait.UntilWithContext(ctx, a.runWorker, time.Second)
 	}
 	a.logger.Info("Started workers")
 
+	go a.runAntiEntropy(ctx)
+	go a.runConfigReloader(ctx)
+	go a.runPermissionsReporter(ctx)
+	go a.runHubHeartbeat(ctx)
+
 	a.initializedTs = time.Now()
 
 	<-ctx.Done()
@@ -182,17 +344,83 @@ func (a *Agent) handleObject(obj any) {
 	ok := rObj.GetObjectKind()
 	gvk := ok.GroupVersionKind()
 	a.logger.V(2).Info("Got object event", gvk.GroupVersion().String(), gvk.Kind, mObj.GetNamespace(), mObj.GetName())
-	a.enqueueObject(obj, false)
+	ctx, span := tracer.Start(context.Background(), "informer.event", trace.WithAttributes(
+		attribute.String("gvk", gvk.String()),
+		attribute.String("namespace", mObj.GetNamespace()),
+		attribute.String("name", mObj.GetName()),
+	))
+	defer span.End()
+	a.enqueueObject(ctx, obj, false)
+}
+
+// Event handler for ManifestWorks on the hub: the status details of a WorkStatus
+// depend on the ManifestWork conditions and its labels are copied from the ManifestWork,
+// so enqueue all objects applied for the ManifestWork to get the WorkStatuses updated.
+func (a *Agent) handleManifestWork(obj any) {
+	manifestWork := obj.(*workv1.ManifestWork)
+	a.logger.V(2).Info("Got manifest work event", "name", manifestWork.Name, "generation", manifestWork.Generation)
+	ctx, span := tracer.Start(context.Background(), "manifestwork.event", trace.WithAttributes(
+		attribute.String("name", manifestWork.Name),
+		attribute.Int64("generation", manifestWork.Generation),
+	))
+	defer span.End()
+	linkManifestWorkTrace(span, manifestWork)
+
+	aWorks, err := ocm.ListAppliedManifestWorksForManifestWork(a.listers, a.hubHash, manifestWork.Name)
+	if err != nil {
+		a.logger.Error(err, "could not list applied manifest works", "manifest-name", manifestWork.Name)
+		return
+	}
+	for _, aWork := range aWorks {
+		a.enqueueAppliedResources(ctx, aWork)
+	}
+}
+
+// enqueueTrackedObjects puts a key for each object applied by any AppliedManifestWork onto the work queue.
+func (a *Agent) enqueueTrackedObjects() {
+	aWorks, err := ocm.ListAppliedManifestWorks(a.listers, a.hubHash)
+	if err != nil {
+		a.logger.Error(err, "could not list applied manifest works")
+		return
+	}
+	for _, aWork := range aWorks {
+		a.enqueueAppliedResources(context.Background(), aWork)
+	}
+}
+
+// enqueueAppliedResources puts a key for each object applied by an AppliedManifestWork onto the work queue.
+// The reconciliations of the objects continue the trace of ctx.
+func (a *Agent) enqueueAppliedResources(ctx context.Context, aWork *workv1.AppliedManifestWork) {
+	traceContext := util.NewTraceContext(ctx)
+	for _, appliedResource := range aWork.Status.AppliedResources {
+		gvk, err := a.restMapper.KindFor(schema.GroupVersionResource{
+			Group:    appliedResource.Group,
+			Version:  appliedResource.Version,
+			Resource: appliedResource.Resource,
+		})
+		if err != nil {
+			a.logger.Error(err, "could not get kind for gvr")
+			continue
+		}
+		if !a.trackingRules.Load().Tracks(gvk.GroupKind(), appliedResource.Namespace) {
+			continue
+		}
+		key := util.KeyForGroupVersionKindAndObjectRef(gvk, appliedResource.Namespace, appliedResource.Name)
+		a.setTraceContext(key, traceContext)
+		a.workqueue.Add(key)
+	}
 }
 
 // enqueueObject converts an object into a key struct which is then put onto the work queue.
-func (a *Agent) enqueueObject(obj interface{}, skipCheckIsDeleted bool) {
+// The reconciliation of the object continues the trace of ctx.
+func (a *Agent) enqueueObject(ctx context.Context, obj interface{}, skipCheckIsDeleted bool) {
 	var key util.Key
 	var err error
 	if key, err = util.KeyForGroupVersionKindNamespaceName(obj); err != nil {
 		utilruntime.HandleError(err)
 		return
 	}
+	a.setTraceContext(key, util.NewTraceContext(ctx))
 	if !skipCheckIsDeleted {
 		// we need to check if object was deleted.
 		// This does not break the best practice of only storing the keys so that
@@ -218,13 +446,13 @@ func (a *Agent) enqueueObject(obj interface{}, skipCheckIsDeleted bool) {
 // processNextWorkItem function in order to read and process a message on the
 // workqueue.
 func (a *Agent) runWorker(ctx context.Context) {
-	for a.processNextWorkItem() {
+	for a.processNextWorkItem(ctx) {
 	}
 }
 
 // processNextWorkItem reads a single work item off the workqueue and
 // attempt to process it by calling the reconcile.
-func (a *Agent) processNextWorkItem() bool {
+func (a *Agent) processNextWorkItem(ctx context.Context) bool {
 	obj, shutdown := a.workqueue.Get()
 	if shutdown {
 		return false
@@ -252,20 +480,28 @@ func (a *Agent) processNextWorkItem() bool {
 			utilruntime.HandleError(fmt.Errorf("expected util.Key in workqueue but got %#v", obj))
 			return nil
 		}
-		// Run the reconciler, passing it the full key or the metav1 Object
-		requeue, err := a.reconcile(key)
+		// Run the reconciler, passing it the full key or the metav1 Object, and the
+		// trace context of the latest traced event of the object
+		traceContext := a.takeTraceContext(key)
+		requeue, err := a.reconcile(ctx, key, traceContext)
 		if err != nil {
+			a.lastErrors.Set(objectKey(key), ObjectError{Error: err.Error(), Time: time.Now()})
+			a.recordReportingFailure(ctx, key, err)
 			// Put the item back on the workqueue to handle any transient errors.
+			a.restoreTraceContext(key, traceContext)
 			a.workqueue.AddRateLimited(obj)
 			return fmt.Errorf("error syncing key '%#v': %s, requeuing", obj, err.Error())
 		}
 		if requeue {
 			// requeue without returning error as this is dne to wait for some other event
+			a.restoreTraceContext(key, traceContext)
 			a.workqueue.AddRateLimited(obj)
 			return nil
 		}
 		// Finally, if no error occurs we Forget this item so it does not
 		// get queued again until another change happens.
+		a.lastErrors.Delete(objectKey(key))
+		a.clearReportingFailure(ctx, key)
 		a.workqueue.Forget(obj)
 		a.logger.V(2).Info("Successfully synced", "object", obj)
 		return nil
@@ -291,11 +527,23 @@ func shouldSkipUpdate(old, new interface{}) bool {
 	return newMObj.GetResourceVersion() == oldMObj.GetResourceVersion()
 }
 
-func getRestMapper(clientSet *kubernetes.Clientset) (meta.RESTMapper, error) {
-	discoveryClient := clientSet.Discovery()
-	groupResources, err := restmapper.GetAPIGroupResources(discoveryClient)
-	if err != nil {
-		return nil, err
+// only the generation and the conditions of a ManifestWork are relevant for the status details,
+// the labels are copied to the WorkStatuses, and the labels and annotations select the ManifestWork
+func shouldSkipManifestWorkUpdate(old, new interface{}) bool {
+	oldMW := old.(*workv1.ManifestWork)
+	newMW := new.(*workv1.ManifestWork)
+	if oldMW.Generation != newMW.Generation ||
+		!equality.Semantic.DeepEqual(oldMW.Labels, newMW.Labels) ||
+		!equality.Semantic.DeepEqual(oldMW.Annotations, newMW.Annotations) ||
+		!equality.Semantic.DeepEqual(oldMW.Status.Conditions, newMW.Status.Conditions) ||
+		len(oldMW.Status.ResourceStatus.Manifests) != len(newMW.Status.ResourceStatus.Manifests) {
+		return false
 	}
-	return restmapper.NewDiscoveryRESTMapper(groupResources), nil
+	for i := range newMW.Status.ResourceStatus.Manifests {
+		if !equality.Semantic.DeepEqual(oldMW.Status.ResourceStatus.Manifests[i].Conditions,
+			newMW.Status.ResourceStatus.Manifests[i].Conditions) {
+			return false
+		}
+	}
+	return true
 }
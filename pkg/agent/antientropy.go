@@ -0,0 +1,214 @@
+package agent
+
+import (
+	"context"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/cache"
+	workv1 "open-cluster-management.io/api/work/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/kubestellar/ocm-status-addon/api/v1alpha1"
+	"github.com/kubestellar/ocm-status-addon/pkg/ocm"
+	"github.com/kubestellar/ocm-status-addon/pkg/util"
+)
+
+// The agent relies on informer events to create and delete WorkStatuses, so events missed
+// while the agent was not running (e.g. deletion of objects or AppliedManifestWorks) or changes
+// made by others to the WorkStatuses on the hub are not repaired by the event handlers.
+// The anti-entropy reconciler compares the WorkStatuses expected for the tracked objects
+// with the WorkStatuses in the cluster namespace on the hub and repairs the differences.
+
+// runAntiEntropy runs the anti-entropy reconciler once the tracking state is synced at startup,
+// and then periodically if a period is set.
+func (a *Agent) runAntiEntropy(ctx context.Context) {
+	a.reconcileWorkStatusesWhenSynced(ctx)
+
+	if a.antiEntropyPeriod <= 0 {
+		return
+	}
+	wait.JitterUntilWithContext(ctx, a.reconcileWorkStatuses, a.antiEntropyPeriod, 0.1, false)
+}
+
+// reconcileWorkStatusesWhenSynced runs the anti-entropy reconciler once the tracking state is synced,
+// or as soon as some kind cannot be watched because of RBAC, as the tracking state then does not
+// sync until permitted. The WorkStatuses are then created and refreshed but not deleted.
+func (a *Agent) reconcileWorkStatusesWhenSynced(ctx context.Context) {
+	err := wait.PollUntilContextCancel(ctx, time.Second, true, func(context.Context) (bool, error) {
+		return a.isTrackingSynced() || len(a.forbiddenKinds.list()) > 0, nil
+	})
+	if err != nil {
+		return
+	}
+	a.reconcileWorkStatuses(ctx)
+}
+
+// isTrackingSynced returns true when all AppliedManifestWorks are tracked and the informers
+// for all the tracked objects have synced, which is required to tell which WorkStatuses
+// are no longer needed.
+func (a *Agent) isTrackingSynced() bool {
+	aWorks, err := ocm.ListAppliedManifestWorks(a.listers, a.hubHash)
+	if err != nil {
+		return false
+	}
+	for _, aWork := range aWorks {
+		if len(aWork.Status.AppliedResources) == 0 {
+			continue
+		}
+		if _, ok := a.trackedAppliedManifests.Get(aWork.Name); !ok {
+			return false
+		}
+		for _, gvr := range ocm.ListGVRs(aWork) {
+			gvk, err := a.restMapper.KindFor(*gvr)
+			if err != nil {
+				return false
+			}
+			if !a.trackingRules.Load().TracksGroupKind(gvk.GroupKind()) {
+				continue
+			}
+			informerIntf, ok := a.informers.Get(util.KeyForGroupVersionKind(gvk.Group, gvk.Version, gvk.Kind))
+			if !ok || !informerIntf.(cache.SharedIndexInformer).HasSynced() {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// reconcileWorkStatuses creates the missing WorkStatuses, refreshes the ones that differ from
+// what was last written by the agent and deletes the ones with no tracked object.
+// WorkStatuses are created and refreshed by enqueueing the related objects.
+func (a *Agent) reconcileWorkStatuses(ctx context.Context) {
+	a.logger.Info("Reconciling workstatuses with tracked objects")
+
+	// deleting is only safe when it is known which objects are tracked
+	complete := a.isTrackingSynced()
+
+	expected, legacy, ok := a.getExpectedWorkStatuses()
+	complete = complete && ok
+
+	list := &v1alpha1.WorkStatusList{}
+	if err := a.hubClient.List(ctx, list, client.InNamespace(a.clusterName)); err != nil {
+		a.logger.Error(err, "could not list workstatuses on hub")
+		return
+	}
+
+	existing := sets.New[string]()
+	for i := range list.Items {
+		existing.Insert(list.Items[i].Name)
+	}
+
+	refreshed, deleted := 0, 0
+	for i := range list.Items {
+		workStatus := &list.Items[i]
+		// a workstatus with a legacy name is deleted once the one with the current name exists,
+		// which is otherwise created below and deletes the legacy one when written
+		if name, ok := legacy[workStatus.Name]; ok && !existing.Has(name) {
+			continue
+		}
+		if key, ok := expected[workStatus.Name]; ok {
+			delete(expected, workStatus.Name)
+			hash, err := hubWorkStatusHash(workStatus)
+			if err != nil {
+				a.logger.Error(err, "could not compute hash for workstatus", "workStatus-name", workStatus.Name)
+				continue
+			}
+			if written, ok := a.getWrittenStatus(workStatus.Name); !ok || written.hash != hash {
+				a.writtenStatuses.Delete(workStatus.Name)
+				a.workqueue.Add(key)
+				refreshed++
+			}
+			continue
+		}
+		_, isLegacy := legacy[workStatus.Name]
+		if !isLegacy && (!complete || !isOwnedByManifestWork(workStatus)) {
+			continue
+		}
+		if err := a.hubClient.Delete(ctx, workStatus, &client.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			a.logger.Error(err, "could not delete orphaned workstatus", "workStatus-name", workStatus.Name)
+			continue
+		}
+		a.writtenStatuses.Delete(workStatus.Name)
+		a.logger.Info("orphaned workStatus deleted", "workStatus-name", workStatus.Name)
+		deleted++
+	}
+
+	for name, key := range expected {
+		a.writtenStatuses.Delete(name)
+		a.workqueue.Add(key)
+	}
+
+	workStatusRepairs.WithLabelValues(repairCreate).Add(float64(len(expected)))
+	workStatusRepairs.WithLabelValues(repairRefresh).Add(float64(refreshed))
+	workStatusRepairs.WithLabelValues(repairDelete).Add(float64(deleted))
+	a.logger.Info("Reconciled workstatuses with tracked objects", "created", len(expected), "refreshed", refreshed,
+		"deleted", deleted, "complete", complete)
+}
+
+// getExpectedWorkStatuses returns the keys of the tracked objects indexed by the name of
+// their WorkStatus, and the names of their WorkStatuses indexed by the legacy names.
+// The returned bool is false if some of the tracked objects could not be found.
+func (a *Agent) getExpectedWorkStatuses() (map[string]util.Key, map[string]string, bool) {
+	expected := map[string]util.Key{}
+	legacy := map[string]string{}
+	aWorks, err := ocm.ListAppliedManifestWorks(a.listers, a.hubHash)
+	if err != nil {
+		a.logger.Error(err, "could not list applied manifest works")
+		return expected, legacy, false
+	}
+
+	complete := true
+	for _, aWork := range aWorks {
+		manifestWork, err := a.manifestWorkLister.ManifestWorks(a.clusterName).Get(aWork.Spec.ManifestWorkName)
+		if err != nil {
+			// the workstatuses of a deleted manifestwork are garbage collected on the hub
+			if !apierrors.IsNotFound(err) {
+				complete = false
+			}
+			continue
+		}
+		if !a.isManifestWorkEligible(manifestWork) {
+			continue
+		}
+		for _, appliedResource := range aWork.Status.AppliedResources {
+			gvk, err := a.restMapper.KindFor(schema.GroupVersionResource{
+				Group:    appliedResource.Group,
+				Version:  appliedResource.Version,
+				Resource: appliedResource.Resource,
+			})
+			if err != nil {
+				complete = false
+				continue
+			}
+			if !a.trackingRules.Load().Tracks(gvk.GroupKind(), appliedResource.Namespace) {
+				continue
+			}
+			key := util.KeyForGroupVersionKindAndObjectRef(gvk, appliedResource.Namespace, appliedResource.Name)
+			obj, err := util.GetObjectFromKey(a.listers, key)
+			if err != nil {
+				if !apierrors.IsNotFound(err) {
+					complete = false
+				}
+				continue
+			}
+			if !ocm.IsManagedByAppliedManifestWork(obj) {
+				continue
+			}
+			name := util.BuildWorkstatusName(*aWork, obj)
+			expected[name] = key
+			legacy[util.BuildLegacyWorkstatusName(*aWork, obj)] = name
+		}
+	}
+	return expected, legacy, complete
+}
+
+// only workstatuses created by the agent are controlled by a ManifestWork
+func isOwnedByManifestWork(workStatus *v1alpha1.WorkStatus) bool {
+	ref := metav1.GetControllerOf(workStatus)
+	return ref != nil && ref.APIVersion == workv1.GroupVersion.String() && ref.Kind == "ManifestWork"
+}
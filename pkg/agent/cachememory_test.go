@@ -0,0 +1,253 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	pkgruntime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+	workv1 "open-cluster-management.io/api/work/v1"
+
+	"github.com/kubestellar/ocm-status-addon/pkg/util"
+)
+
+// TestInformerCacheMemory measures the memory of the agent with an informer caching the Pods of a
+// cluster, with the setting of the informer given by AGENT_CACHE_MEMORY: "baseline" for no transform,
+// "transforms" for the transforms of the cached objects, and "metadata-only" for a metadata-only
+// informer. It is skipped when AGENT_CACHE_MEMORY is not set, and is run in a separate process for
+// each setting by hack/agent-cache-memory.sh. The informer lists the objects from a generator instead
+// of an API server, so that the objects are only held by the cache.
+func TestInformerCacheMemory(t *testing.T) {
+	setting := os.Getenv("AGENT_CACHE_MEMORY")
+	if setting == "" {
+		t.Skip("AGENT_CACHE_MEMORY is not set")
+	}
+	applied := envInt(t, "AGENT_CACHE_MEMORY_APPLIED", 1000)
+	other := envInt(t, "AGENT_CACHE_MEMORY_OTHER", 4000)
+	gvk := schema.GroupVersionKind{Version: "v1", Kind: "Pod"}
+
+	var informer cache.SharedIndexInformer
+	switch setting {
+	case "baseline", "transforms":
+		informer = cache.NewSharedIndexInformer(&cache.ListWatch{
+			ListWithContextFunc: func(context.Context, metav1.ListOptions) (pkgruntime.Object, error) {
+				list := &unstructured.UnstructuredList{}
+				for i := 0; i < applied+other; i++ {
+					u := &unstructured.Unstructured{}
+					if err := json.Unmarshal(testPodJSON(t, i, i < applied), &u.Object); err != nil {
+						return nil, err
+					}
+					list.Items = append(list.Items, *u)
+				}
+				list.SetResourceVersion("1")
+				return list, nil
+			},
+			WatchFuncWithContext: func(context.Context, metav1.ListOptions) (watch.Interface, error) {
+				return watch.NewFake(), nil
+			},
+		}, &unstructured.Unstructured{}, 0, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+		if setting == "transforms" {
+			if err := informer.SetTransform(newObjectTransform(true)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	case "metadata-only":
+		informer = cache.NewSharedIndexInformer(&cache.ListWatch{
+			ListWithContextFunc: func(context.Context, metav1.ListOptions) (pkgruntime.Object, error) {
+				list := &metav1.PartialObjectMetadataList{}
+				for i := 0; i < applied+other; i++ {
+					partial := metav1.PartialObjectMetadata{}
+					if err := json.Unmarshal(testPodJSON(t, i, i < applied), &partial); err != nil {
+						return nil, err
+					}
+					list.Items = append(list.Items, partial)
+				}
+				list.SetResourceVersion("1")
+				return list, nil
+			},
+			WatchFuncWithContext: func(context.Context, metav1.ListOptions) (watch.Interface, error) {
+				return watch.NewFake(), nil
+			},
+		}, &metav1.PartialObjectMetadata{}, 0, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+		if err := informer.SetTransform(newMetadataTransform(gvk)); err != nil {
+			t.Fatal(err)
+		}
+	default:
+		t.Fatalf("unknown setting %q, expected baseline, transforms or metadata-only", setting)
+	}
+
+	stopper := make(chan struct{})
+	defer close(stopper)
+	go informer.Run(stopper)
+	if !cache.WaitForCacheSync(stopper, informer.HasSynced) {
+		t.Fatal("cache not synced")
+	}
+	if count := len(informer.GetStore().List()); count != applied+other {
+		t.Fatalf("got %d cached objects, expected %d", count, applied+other)
+	}
+
+	// the list is released once processed, as it is by the reflector of the agent
+	runtime.GC()
+	time.Sleep(time.Second)
+	runtime.GC()
+	memStats := runtime.MemStats{}
+	runtime.ReadMemStats(&memStats)
+	fmt.Printf("setting=%s objects=%d applied=%d heap_inuse_bytes=%d rss_bytes=%d\n",
+		setting, applied+other, applied, memStats.HeapInuse, residentMemory(t))
+	runtime.KeepAlive(informer)
+}
+
+func envInt(t *testing.T, name string, defaultValue int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		t.Fatalf("invalid %s: %v", name, err)
+	}
+	return n
+}
+
+// residentMemory returns the resident memory of the process, as reported by the process collector
+func residentMemory(t *testing.T) int64 {
+	data, err := os.ReadFile("/proc/self/status")
+	if err != nil {
+		t.Skipf("resident memory not available: %v", err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if fields := strings.Fields(line); len(fields) == 3 && fields[0] == "VmRSS:" {
+			kb, _ := strconv.ParseInt(fields[1], 10, 64)
+			return kb * 1024
+		}
+	}
+	t.Skip("resident memory not available")
+	return 0
+}
+
+// testPodJSON returns the JSON of a Pod as served by an API server, with its managed fields and the last
+// applied configuration, applied by an AppliedManifestWork or not
+func testPodJSON(t *testing.T, i int, applied bool) []byte {
+	name := fmt.Sprintf("app-%d-7d9f8b6c5-%05d", i%50, i)
+	namespace := fmt.Sprintf("team-%d", i%20)
+	labels := map[string]string{
+		"app.kubernetes.io/name":      fmt.Sprintf("app-%d", i%50),
+		"app.kubernetes.io/instance":  fmt.Sprintf("app-%d-prod", i%50),
+		"app.kubernetes.io/component": "server",
+		"pod-template-hash":           "7d9f8b6c5",
+	}
+	env := []corev1.EnvVar{}
+	for j := 0; j < 12; j++ {
+		env = append(env, corev1.EnvVar{Name: fmt.Sprintf("SETTING_%d", j), Value: fmt.Sprintf("value-of-setting-%d-for-app", j)})
+	}
+	container := func(name string) corev1.Container {
+		return corev1.Container{
+			Name:  name,
+			Image: "registry.example.com/team/" + name + ":v1.2.3",
+			Args:  []string{"--port=8080", "--log-level=info", "--config=/etc/app/config.yaml"},
+			Env:   env,
+			Ports: []corev1.ContainerPort{{Name: "http", ContainerPort: 8080, Protocol: corev1.ProtocolTCP}},
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m"), corev1.ResourceMemory: resource.MustParse("128Mi")},
+				Limits:   corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("500m"), corev1.ResourceMemory: resource.MustParse("512Mi")},
+			},
+			VolumeMounts: []corev1.VolumeMount{
+				{Name: "config", MountPath: "/etc/app"},
+				{Name: "kube-api-access", MountPath: "/var/run/secrets/kubernetes.io/serviceaccount", ReadOnly: true},
+			},
+			ReadinessProbe: &corev1.Probe{ProbeHandler: corev1.ProbeHandler{HTTPGet: &corev1.HTTPGetAction{Path: "/healthz"}}},
+		}
+	}
+	spec := corev1.PodSpec{
+		Containers:         []corev1.Container{container("server"), container("sidecar")},
+		ServiceAccountName: "default",
+		NodeName:           fmt.Sprintf("node-%d", i%10),
+		Volumes: []corev1.Volume{
+			{Name: "config", VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "app-config"}}}},
+			{Name: "kube-api-access", VolumeSource: corev1.VolumeSource{Projected: &corev1.ProjectedVolumeSource{}}},
+		},
+		Tolerations: []corev1.Toleration{
+			{Key: "node.kubernetes.io/not-ready", Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoExecute},
+			{Key: "node.kubernetes.io/unreachable", Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoExecute},
+		},
+	}
+	lastApplied, err := json.Marshal(corev1.Pod{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, Labels: labels},
+		Spec:       spec,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	managedFields := []metav1.ManagedFieldsEntry{}
+	for _, manager := range []string{"kube-controller-manager", "kubelet", "kubectl-client-side-apply"} {
+		managedFields = append(managedFields, metav1.ManagedFieldsEntry{
+			Manager:    manager,
+			Operation:  metav1.ManagedFieldsOperationUpdate,
+			APIVersion: "v1",
+			FieldsType: "FieldsV1",
+			FieldsV1: &metav1.FieldsV1{Raw: []byte(`{"f:metadata":{"f:labels":{".":{},"f:app.kubernetes.io/name":{},` +
+				`"f:pod-template-hash":{}}},"f:spec":{"f:containers":{"k:{\"name\":\"server\"}":{".":{},"f:args":{},"f:env":{".":{},` +
+				`"k:{\"name\":\"SETTING_0\"}":{".":{},"f:name":{},"f:value":{}}},"f:image":{},"f:name":{},"f:ports":{},"f:resources":{}}}},` +
+				`"f:status":{"f:conditions":{"k:{\"type\":\"Ready\"}":{".":{},"f:lastTransitionTime":{},"f:status":{},"f:type":{}}},` +
+				`"f:containerStatuses":{},"f:hostIP":{},"f:phase":{},"f:podIP":{},"f:podIPs":{},"f:startTime":{}}}`)},
+		})
+	}
+	pod := corev1.Pod{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			Namespace:         namespace,
+			UID:               types.UID(fmt.Sprintf("4c1f8d2e-9b7a-4e6f-8d5c-%012d", i)),
+			ResourceVersion:   strconv.Itoa(100000 + i),
+			CreationTimestamp: metav1.Time{Time: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)},
+			Labels:            labels,
+			Annotations:       map[string]string{lastAppliedConfigAnnotationKey: string(lastApplied)},
+			ManagedFields:     managedFields,
+		},
+		Spec: spec,
+		Status: corev1.PodStatus{
+			Phase:  corev1.PodRunning,
+			HostIP: "10.0.0.1",
+			PodIP:  fmt.Sprintf("10.244.%d.%d", i/250, i%250),
+			Conditions: []corev1.PodCondition{
+				{Type: corev1.PodInitialized, Status: corev1.ConditionTrue},
+				{Type: corev1.PodReady, Status: corev1.ConditionTrue},
+				{Type: corev1.ContainersReady, Status: corev1.ConditionTrue},
+				{Type: corev1.PodScheduled, Status: corev1.ConditionTrue},
+			},
+			ContainerStatuses: []corev1.ContainerStatus{
+				{Name: "server", Ready: true, Image: "registry.example.com/team/server:v1.2.3", ContainerID: "containerd://" + strings.Repeat("a", 64)},
+				{Name: "sidecar", Ready: true, Image: "registry.example.com/team/sidecar:v1.2.3", ContainerID: "containerd://" + strings.Repeat("b", 64)},
+			},
+		},
+	}
+	if applied {
+		pod.OwnerReferences = []metav1.OwnerReference{{
+			APIVersion: workv1.GroupVersion.String(),
+			Kind:       util.AppliedManifestWorkKind,
+			Name:       fmt.Sprintf("%064d-work-%d", i, i),
+			UID:        "9e8d7c6b-5a4f-4e3d-8c2b-1a0f9e8d7c6b",
+		}}
+	}
+	data, err := json.Marshal(pod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
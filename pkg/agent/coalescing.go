@@ -0,0 +1,122 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+
+	"github.com/kubestellar/ocm-status-addon/api/v1alpha1"
+	"github.com/kubestellar/ocm-status-addon/pkg/tracking"
+	"github.com/kubestellar/ocm-status-addon/pkg/util"
+)
+
+// Objects with a frequently changing status (e.g. Pods in CrashLoopBackOff or HPAs) would cause
+// a write to the hub on every change. The updates of the WorkStatus of an object are spaced by
+// a minimum interval, set for all kinds with per-GroupKind overrides. An update within the interval
+// is deferred to its end by adding the object back to the work queue, where the events of the object
+// are merged, so that only the latest state is written. The creations, the deletions and the updates
+// with a condition transition are written immediately.
+
+// reportIntervals holds the minimum intervals between the updates of the WorkStatus of an object
+type reportIntervals struct {
+	defaultInterval time.Duration
+	// the first override matching the kind of an object applies
+	overrides []reportIntervalOverride
+}
+
+type reportIntervalOverride struct {
+	rule     tracking.Rule
+	interval time.Duration
+}
+
+// parseReportIntervals parses the overrides in the form group/kind=duration[,group/kind=duration...],
+// for example "/Pod=30s,autoscaling/HorizontalPodAutoscaler=1m".
+func parseReportIntervals(defaultInterval time.Duration, overrides string) (reportIntervals, error) {
+	result := reportIntervals{defaultInterval: defaultInterval}
+	for _, entry := range strings.Split(overrides, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		ruleValue, intervalValue, found := strings.Cut(entry, "=")
+		if !found {
+			return reportIntervals{}, fmt.Errorf("invalid report interval override %q, expected group/kind=duration", entry)
+		}
+		rules, err := tracking.ParseRules(ruleValue)
+		if err != nil {
+			return reportIntervals{}, err
+		}
+		if len(rules) != 1 || len(rules[0].Namespaces) > 0 {
+			return reportIntervals{}, fmt.Errorf("invalid report interval override %q, expected group/kind=duration", entry)
+		}
+		interval, err := time.ParseDuration(intervalValue)
+		if err != nil {
+			return reportIntervals{}, fmt.Errorf("invalid report interval override %q: %w", entry, err)
+		}
+		result.overrides = append(result.overrides, reportIntervalOverride{rule: rules[0], interval: interval})
+	}
+	return result, nil
+}
+
+// forGroupKind returns the minimum interval between the updates of the WorkStatuses of a kind
+func (r reportIntervals) forGroupKind(gk schema.GroupKind) time.Duration {
+	for _, override := range r.overrides {
+		if tracking.MatchesGroupKind([]tracking.Rule{override.rule}, gk) {
+			return override.interval
+		}
+	}
+	return r.defaultInterval
+}
+
+// updateDelay returns how long the update of a WorkStatus has to be deferred, which is 0 when
+// the minimum interval since the last write has passed or when a condition changed its status.
+func (a *Agent) updateDelay(gk schema.GroupKind, written writtenStatus, conditions string) time.Duration {
+	interval := a.reportIntervals.forGroupKind(gk)
+	if interval <= 0 || written.writtenAt.IsZero() || written.conditions != conditions {
+		return 0
+	}
+	return time.Until(written.writtenAt.Add(interval))
+}
+
+// deferUpdate adds an object back to the work queue when its update can be written. The key
+// identifies the object only, so that it is merged with the other deferred updates of the object.
+func (a *Agent) deferUpdate(obj runtime.Object, delay time.Duration) {
+	key, err := util.KeyForGroupVersionKindNamespaceName(obj)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	workStatusUpdatesDeferred.Inc()
+	a.workqueue.AddAfter(key, delay)
+}
+
+// conditionStates returns the type and status of the conditions in the status and health of
+// a WorkStatus, in a form that can be compared to tell the condition transitions.
+func conditionStates(workStatus *v1alpha1.WorkStatus) string {
+	states := []string{}
+	status := struct {
+		Conditions []struct {
+			Type   string `json:"type"`
+			Status string `json:"status"`
+		} `json:"conditions"`
+	}{}
+	// a status without conditions, or with conditions in another form, has no transitions
+	if len(workStatus.Status.Raw) > 0 && json.Unmarshal(workStatus.Status.Raw, &status) == nil {
+		for _, condition := range status.Conditions {
+			states = append(states, "status:"+condition.Type+"="+condition.Status)
+		}
+	}
+	if workStatus.Health != nil {
+		for _, condition := range workStatus.Health.Conditions {
+			states = append(states, "health:"+condition.Type+"="+string(condition.Status))
+		}
+	}
+	sort.Strings(states)
+	return strings.Join(states, ",")
+}
@@ -0,0 +1,186 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"github.com/kubestellar/ocm-status-addon/pkg/projection"
+	"github.com/kubestellar/ocm-status-addon/pkg/redaction"
+	"github.com/kubestellar/ocm-status-addon/pkg/tracking"
+	"github.com/kubestellar/ocm-status-addon/pkg/util"
+)
+
+// interval for checking the configuration files for changes. Polling is used as files
+// projected from ConfigMaps are updated by swapping symlinks.
+const configReloadInterval = 10 * time.Second
+
+// runConfigReloader reloads the tracking rules, the status projections and the status redaction
+// rules when their files change.
+func (a *Agent) runConfigReloader(ctx context.Context) {
+	if a.trackingRulesFile == "" && a.statusProjectionFile == "" && a.statusRedactionFile == "" {
+		return
+	}
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		a.reloadStatusProjection()
+		a.reloadStatusRedaction()
+		a.reloadTrackingRules(ctx)
+	}, configReloadInterval)
+}
+
+// loadStatusProjection reads the status projection file and sets the status projector.
+// Returns true if the file changed since the last time it was read.
+func (a *Agent) loadStatusProjection() (bool, error) {
+	if a.statusProjectionFile == "" {
+		return false, nil
+	}
+	projector, data, err := projection.ReadFile(a.statusProjectionFile)
+	if err != nil {
+		return false, err
+	}
+	if bytes.Equal(data, a.statusProjectionFileData) {
+		return false, nil
+	}
+	a.statusProjectionFileData = data
+	a.statusProjector.Store(projector)
+	return true, nil
+}
+
+// reloadStatusProjection reloads the status projections when the file changes,
+// and enqueues all tracked objects to report their status with the new projections.
+func (a *Agent) reloadStatusProjection() {
+	changed, err := a.loadStatusProjection()
+	if err != nil {
+		a.logger.Error(err, "could not reload status projection, keeping current projection", "file", a.statusProjectionFile)
+		return
+	}
+	if !changed {
+		return
+	}
+	a.logger.Info("Status projection changed", "file", a.statusProjectionFile)
+	a.enqueueTrackedObjects()
+}
+
+// loadStatusRedaction reads the status redaction file and sets the status redactor.
+// Returns true if the file changed since the last time it was read.
+func (a *Agent) loadStatusRedaction() (bool, error) {
+	if a.statusRedactionFile == "" {
+		return false, nil
+	}
+	redactor, data, err := redaction.ReadFile(a.statusRedactionFile, a.redactionKeys, a.redactionSalt)
+	if err != nil {
+		return false, err
+	}
+	if bytes.Equal(data, a.statusRedactionFileData) {
+		return false, nil
+	}
+	a.statusRedactionFileData = data
+	a.statusRedactor.Store(redactor)
+	if redactor.HashesRemoved() {
+		a.logger.Error(errors.New("no redaction salt"), "The values to hash are removed instead, "+
+			"set the salt key of the status-agent-redaction-salt Secret in the agent namespace to hash them",
+			"file", a.statusRedactionFile)
+	}
+	return true, nil
+}
+
+// reloadStatusRedaction reloads the status redaction rules when the file changes,
+// and enqueues all tracked objects to report their status with the new rules.
+func (a *Agent) reloadStatusRedaction() {
+	changed, err := a.loadStatusRedaction()
+	if err != nil {
+		a.logger.Error(err, "could not reload status redaction, keeping current rules", "file", a.statusRedactionFile)
+		return
+	}
+	if !changed {
+		return
+	}
+	a.logger.Info("Status redaction changed", "file", a.statusRedactionFile)
+	a.enqueueTrackedObjects()
+}
+
+// readRedactionSalt reads the salt of the hashes of redacted values. Returns no salt when there is
+// no salt file, in which case the values to hash are removed.
+func readRedactionSalt(file string) ([]byte, error) {
+	if file == "" {
+		return nil, nil
+	}
+	salt, err := os.ReadFile(file)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	return salt, nil
+}
+
+// loadTrackingRules reads the tracking rules file and sets the tracking rules to the rules
+// set by flags combined with the rules in the file. Returns true if the file changed since
+// the last time it was read.
+func (a *Agent) loadTrackingRules() (bool, error) {
+	if a.trackingRulesFile == "" {
+		return false, nil
+	}
+	fileRules, data, err := tracking.ReadRulesFile(a.trackingRulesFile)
+	if err != nil {
+		return false, err
+	}
+	if bytes.Equal(data, a.trackingRulesFileData) {
+		return false, nil
+	}
+	a.trackingRulesFileData = data
+	rules := a.flagTrackingRules.Merge(fileRules)
+	a.trackingRules.Store(&rules)
+	return true, nil
+}
+
+// reloadTrackingRules reloads the tracking rules when the rules file changes, then starts
+// and stops informers as needed and reconciles the WorkStatuses with the newly tracked objects.
+func (a *Agent) reloadTrackingRules(ctx context.Context) {
+	changed, err := a.loadTrackingRules()
+	if err != nil {
+		a.logger.Error(err, "could not reload tracking rules, keeping current rules", "file", a.trackingRulesFile)
+		return
+	}
+	if !changed {
+		return
+	}
+	a.logger.Info("Tracking rules changed", "file", a.trackingRulesFile, "rules", a.trackingRules.Load())
+	a.applyTrackingRules()
+	a.reconcileWorkStatusesWhenSynced(ctx)
+}
+
+// applyTrackingRules starts the informers for the kinds of tracked objects that are now
+// selected by the tracking rules, and stops the ones for kinds no longer selected.
+func (a *Agent) applyTrackingRules() {
+	rules := a.trackingRules.Load()
+	for _, infoIntf := range a.trackedAppliedManifests.ListValues() {
+		info := infoIntf.(util.AppliedManifestInfo)
+		added, removed := util.AppliedManifestInfo{}, util.AppliedManifestInfo{}
+		for i, gvr := range info.GVRs {
+			gvk, err := a.restMapper.KindFor(*gvr)
+			if err != nil {
+				a.logger.Error(err, "could not get kind for gvr")
+				continue
+			}
+			key := util.KeyForGroupVersionKind(gvk.Group, gvk.Version, gvk.Kind)
+			counted := a.objectsCount.HasUID(key, info.ObjectUIDs[i])
+			tracked := rules.TracksGroupKind(gvk.GroupKind())
+			if tracked && !counted {
+				added.GVRs = append(added.GVRs, gvr)
+				added.ObjectUIDs = append(added.ObjectUIDs, info.ObjectUIDs[i])
+			} else if !tracked && counted {
+				removed.GVRs = append(removed.GVRs, gvr)
+				removed.ObjectUIDs = append(removed.ObjectUIDs, info.ObjectUIDs[i])
+			}
+		}
+		if len(added.GVRs) > 0 {
+			a.startInformers(added.GVRs, added.ObjectUIDs)
+		}
+		if len(removed.GVRs) > 0 {
+			a.stopInformers(removed)
+		}
+	}
+}
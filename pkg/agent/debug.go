@@ -0,0 +1,131 @@
+package agent
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"k8s.io/client-go/tools/cache"
+	ctrlm "sigs.k8s.io/controller-runtime/pkg/manager"
+
+	"github.com/kubestellar/ocm-status-addon/pkg/util"
+)
+
+// TrackingDebugPath is the path on the metrics server of the agent of the endpoint returning
+// what the agent tracks, for troubleshooting missing statuses
+const TrackingDebugPath = "/debug/tracking"
+
+// TrackingState is the tracking state of the agent returned by the debug endpoint
+type TrackingState struct {
+	// the AppliedManifestWorks tracked, by name
+	TrackedAppliedManifests map[string]TrackedAppliedManifest `json:"trackedAppliedManifests"`
+	// the number of tracked object UIDs, by informer key
+	ObjectsCount map[string]int           `json:"objectsCount"`
+	Informers    map[string]InformerState `json:"informers"`
+	Queue        QueueState               `json:"queue"`
+	// the last error of the objects whose last reconciliation failed, by object key
+	LastErrors map[string]ObjectError `json:"lastErrors"`
+}
+
+type TrackedAppliedManifest struct {
+	GVRs       []string `json:"gvrs"`
+	ObjectUIDs []string `json:"objectUIDs"`
+}
+
+type InformerState struct {
+	Synced    bool `json:"synced"`
+	Forbidden bool `json:"forbidden,omitempty"`
+}
+
+// QueueState holds the items of the work queue that are queued, being processed, and waiting to
+// be added (retries after a backoff and deferred updates)
+type QueueState struct {
+	Queued     []QueueItem `json:"queued"`
+	Processing []QueueItem `json:"processing"`
+	Waiting    []QueueItem `json:"waiting"`
+}
+
+type QueueItem struct {
+	Key      string     `json:"key"`
+	Class    string     `json:"class,omitempty"`
+	Deleted  bool       `json:"deleted,omitempty"`
+	Requeues int        `json:"requeues"`
+	ReadyAt  *time.Time `json:"readyAt,omitempty"`
+}
+
+type ObjectError struct {
+	Error string    `json:"error"`
+	Time  time.Time `json:"time"`
+}
+
+// AddDebugHandler adds the endpoint returning the tracking state to the metrics server of the manager
+func (a *Agent) AddDebugHandler(mgr ctrlm.Manager) error {
+	return mgr.AddMetricsServerExtraHandler(TrackingDebugPath, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(a.getTrackingState()); err != nil {
+			a.logger.Error(err, "could not write tracking state")
+		}
+	}))
+}
+
+func (a *Agent) getTrackingState() TrackingState {
+	state := TrackingState{
+		TrackedAppliedManifests: map[string]TrackedAppliedManifest{},
+		ObjectsCount:            a.objectsCount.GetUIDCounts(),
+		Informers:               map[string]InformerState{},
+		LastErrors:              map[string]ObjectError{},
+	}
+	for name, infoIntf := range a.trackedAppliedManifests.Snapshot() {
+		info := infoIntf.(util.AppliedManifestInfo)
+		tracked := TrackedAppliedManifest{GVRs: []string{}, ObjectUIDs: info.ObjectUIDs}
+		for _, gvr := range info.GVRs {
+			tracked.GVRs = append(tracked.GVRs, gvr.String())
+		}
+		state.TrackedAppliedManifests[name] = tracked
+	}
+	for gvkKey, informerIntf := range a.informers.Snapshot() {
+		state.Informers[gvkKey] = InformerState{
+			Synced:    informerIntf.(cache.SharedIndexInformer).HasSynced(),
+			Forbidden: a.forbiddenKinds.has(gvkKey),
+		}
+	}
+	for key, errIntf := range a.lastErrors.Snapshot() {
+		state.LastErrors[key] = errIntf.(ObjectError)
+	}
+
+	queued, processing, waiting := a.workqueue.entries()
+	state.Queue = QueueState{
+		Queued:     a.toQueueItems(queued),
+		Processing: a.toQueueItems(processing),
+		Waiting:    a.toQueueItems(waiting),
+	}
+	return state
+}
+
+// toQueueItems returns the items of the work queue sorted by key
+func (a *Agent) toQueueItems(entries []queueEntry) []QueueItem {
+	items := []QueueItem{}
+	for _, entry := range entries {
+		key, ok := entry.item.(util.Key)
+		if !ok {
+			continue
+		}
+		item := QueueItem{
+			Key:      objectKey(key),
+			Deleted:  key.DeletedObject != nil,
+			Requeues: a.workqueue.NumRequeues(entry.item),
+		}
+		if entry.readyAt.IsZero() {
+			item.Class = queueClassNames[entry.class]
+		} else {
+			readyAt := entry.readyAt
+			item.ReadyAt = &readyAt
+		}
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Key < items[j].Key })
+	return items
+}
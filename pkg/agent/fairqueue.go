@@ -0,0 +1,370 @@
+package agent
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/client-go/util/workqueue"
+)
+
+// The work queue of the agent is shared by the events of all the tracked kinds. In order for the
+// objects of a kind with many changes (e.g. Pods) not to delay the objects of the other kinds, the
+// queue round-robins across flows, one per kind, within each class of items. The classes are served
+// by priority, so that deletions and first reports go ahead of routine updates, and the routine
+// updates are served first one time out of routineShare so that they cannot be starved.
+
+// classes of the items in the work queue, by decreasing priority
+const (
+	queueClassDelete = iota
+	queueClassCreate
+	queueClassUpdate
+)
+
+var queueClassNames = []string{"delete", "create", "update"}
+
+// one Get out of routineShare serves the routine updates first
+const routineShare = 5
+
+// fairQueue is a rate limiting work queue with fair queuing across flows and priority classes.
+// As with the client-go work queue, an item is queued at most once, and an item added while it is
+// processed is queued again when done.
+type fairQueue struct {
+	cond *sync.Cond
+
+	classOf func(item any) int
+	flowOf  func(item any) string
+
+	classes    []*queueClass
+	dirty      map[any]int // class of the queued items
+	processing map[any]struct{}
+	addedAt    map[any]time.Time
+	waiting    map[any]*waitingItem
+	gets       int
+	lastGet    time.Time
+
+	shuttingDown bool
+	drain        bool
+
+	rateLimiter workqueue.RateLimiter
+}
+
+var _ workqueue.RateLimitingInterface = &fairQueue{}
+
+// queueClass holds the queued items of a class by flow, with the flows served in turn
+type queueClass struct {
+	flows map[string][]any
+	ring  []string
+	next  int
+}
+
+type waitingItem struct {
+	readyAt time.Time
+	timer   *time.Timer
+}
+
+func newFairQueue(rateLimiter workqueue.RateLimiter, classOf func(item any) int, flowOf func(item any) string) *fairQueue {
+	q := &fairQueue{
+		cond:        sync.NewCond(&sync.Mutex{}),
+		classOf:     classOf,
+		flowOf:      flowOf,
+		dirty:       map[any]int{},
+		processing:  map[any]struct{}{},
+		addedAt:     map[any]time.Time{},
+		waiting:     map[any]*waitingItem{},
+		rateLimiter: rateLimiter,
+	}
+	for range queueClassNames {
+		q.classes = append(q.classes, &queueClass{flows: map[string][]any{}})
+	}
+	return q
+}
+
+// Add queues an item, or moves it to a class of higher priority if already queued
+func (q *fairQueue) Add(item any) {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	if q.shuttingDown {
+		return
+	}
+	class := q.classOf(item)
+	_, processing := q.processing[item]
+	if current, ok := q.dirty[item]; ok {
+		if class >= current {
+			return
+		}
+		if !processing {
+			q.classes[current].remove(q.flowOf(item), item)
+			queueDepth.WithLabelValues(queueClassNames[current]).Dec()
+		}
+	} else {
+		q.addedAt[item] = time.Now()
+	}
+	q.dirty[item] = class
+	queueAdds.WithLabelValues(queueClassNames[class]).Inc()
+	if processing {
+		// queued again when done
+		return
+	}
+	q.push(item, class)
+}
+
+func (q *fairQueue) push(item any, class int) {
+	q.classes[class].push(q.flowOf(item), item)
+	queueDepth.WithLabelValues(queueClassNames[class]).Inc()
+	q.cond.Signal()
+}
+
+func (q *fairQueue) Len() int {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	length := 0
+	for _, class := range q.classes {
+		length += class.len()
+	}
+	return length
+}
+
+// Get blocks until an item can be processed, and returns the next item in turn
+func (q *fairQueue) Get() (any, bool) {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	for q.len() == 0 && !q.shuttingDown {
+		q.cond.Wait()
+	}
+	if q.len() == 0 {
+		return nil, true
+	}
+
+	q.gets++
+	q.lastGet = time.Now()
+	order := []int{queueClassDelete, queueClassCreate, queueClassUpdate}
+	if q.gets%routineShare == 0 {
+		order = []int{queueClassUpdate, queueClassDelete, queueClassCreate}
+	}
+	for _, class := range order {
+		item, ok := q.classes[class].pop()
+		if !ok {
+			continue
+		}
+		queueDepth.WithLabelValues(queueClassNames[class]).Dec()
+		queueDuration.WithLabelValues(queueClassNames[class]).Observe(time.Since(q.addedAt[item]).Seconds())
+		delete(q.dirty, item)
+		delete(q.addedAt, item)
+		q.processing[item] = struct{}{}
+		return item, false
+	}
+	return nil, true
+}
+
+// Done marks an item as processed, and queues it again if it was added while processed
+func (q *fairQueue) Done(item any) {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	delete(q.processing, item)
+	if class, ok := q.dirty[item]; ok {
+		q.push(item, class)
+	} else if len(q.processing) == 0 {
+		q.cond.Broadcast()
+	}
+}
+
+func (q *fairQueue) ShutDown() {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	q.shutDown()
+}
+
+// ShutDownWithDrain shuts down the queue and waits for the items being processed to be done
+func (q *fairQueue) ShutDownWithDrain() {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	q.drain = true
+	q.shutDown()
+	for len(q.processing) > 0 && q.drain {
+		q.cond.Wait()
+	}
+}
+
+func (q *fairQueue) shutDown() {
+	q.shuttingDown = true
+	for _, w := range q.waiting {
+		w.timer.Stop()
+	}
+	q.waiting = map[any]*waitingItem{}
+	q.cond.Broadcast()
+}
+
+func (q *fairQueue) ShuttingDown() bool {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	return q.shuttingDown
+}
+
+// AddAfter adds an item once the duration has passed. An item waiting to be added is added
+// at the earliest of the times it was requested for.
+func (q *fairQueue) AddAfter(item any, duration time.Duration) {
+	if duration <= 0 {
+		q.Add(item)
+		return
+	}
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	if q.shuttingDown {
+		return
+	}
+	readyAt := time.Now().Add(duration)
+	if w, ok := q.waiting[item]; ok {
+		if !readyAt.Before(w.readyAt) {
+			return
+		}
+		w.timer.Stop()
+	}
+	w := &waitingItem{readyAt: readyAt}
+	w.timer = time.AfterFunc(duration, func() {
+		q.cond.L.Lock()
+		current, ok := q.waiting[item]
+		if ok && current == w {
+			delete(q.waiting, item)
+		}
+		q.cond.L.Unlock()
+		if ok && current == w {
+			q.Add(item)
+		}
+	})
+	q.waiting[item] = w
+}
+
+func (q *fairQueue) AddRateLimited(item any) {
+	queueRetries.Inc()
+	q.AddAfter(item, q.rateLimiter.When(item))
+}
+
+func (q *fairQueue) Forget(item any) {
+	q.rateLimiter.Forget(item)
+}
+
+func (q *fairQueue) NumRequeues(item any) int {
+	return q.rateLimiter.NumRequeues(item)
+}
+
+// stalledFor returns for how long items have been queued without any item being picked up, or 0
+// if no item is queued or no worker ever picked up an item (e.g. while the caches sync).
+func (q *fairQueue) stalledFor() time.Duration {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	if q.lastGet.IsZero() {
+		return 0
+	}
+	var oldest time.Time
+	for item, addedAt := range q.addedAt {
+		// an item added while processed is not queued until done
+		if _, ok := q.processing[item]; ok {
+			continue
+		}
+		if oldest.IsZero() || addedAt.Before(oldest) {
+			oldest = addedAt
+		}
+	}
+	if oldest.IsZero() {
+		return 0
+	}
+	if oldest.Before(q.lastGet) {
+		oldest = q.lastGet
+	}
+	return time.Since(oldest)
+}
+
+// queueEntry is an item of the queue with its class, or with the time it is added at when waiting
+type queueEntry struct {
+	item    any
+	class   int
+	readyAt time.Time
+}
+
+// entries returns the items that are queued, processed and waiting to be added
+func (q *fairQueue) entries() (queued, processing, waiting []queueEntry) {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	for item, class := range q.dirty {
+		if _, ok := q.processing[item]; !ok {
+			queued = append(queued, queueEntry{item: item, class: class})
+		}
+	}
+	for item := range q.processing {
+		processing = append(processing, queueEntry{item: item, class: q.classOf(item)})
+	}
+	for item, w := range q.waiting {
+		waiting = append(waiting, queueEntry{item: item, readyAt: w.readyAt})
+	}
+	return queued, processing, waiting
+}
+
+func (q *fairQueue) len() int {
+	length := 0
+	for _, class := range q.classes {
+		length += class.len()
+	}
+	return length
+}
+
+func (c *queueClass) len() int {
+	length := 0
+	for _, items := range c.flows {
+		length += len(items)
+	}
+	return length
+}
+
+func (c *queueClass) push(flow string, item any) {
+	if _, ok := c.flows[flow]; !ok {
+		c.ring = append(c.ring, flow)
+	}
+	c.flows[flow] = append(c.flows[flow], item)
+}
+
+// pop returns the first item of the next flow in turn
+func (c *queueClass) pop() (any, bool) {
+	if len(c.ring) == 0 {
+		return nil, false
+	}
+	c.next %= len(c.ring)
+	flow := c.ring[c.next]
+	items := c.flows[flow]
+	item := items[0]
+	if len(items) == 1 {
+		c.removeFlow(flow)
+	} else {
+		c.flows[flow] = items[1:]
+		c.next++
+	}
+	return item, true
+}
+
+func (c *queueClass) remove(flow string, item any) {
+	items := c.flows[flow]
+	for i := range items {
+		if items[i] == item {
+			items = append(items[:i], items[i+1:]...)
+			break
+		}
+	}
+	if len(items) == 0 {
+		c.removeFlow(flow)
+		return
+	}
+	c.flows[flow] = items
+}
+
+// removeFlow removes an empty flow, the flow after it in the ring is served next
+func (c *queueClass) removeFlow(flow string) {
+	delete(c.flows, flow)
+	for i := range c.ring {
+		if c.ring[i] == flow {
+			c.ring = append(c.ring[:i], c.ring[i+1:]...)
+			if i < c.next {
+				c.next--
+			}
+			break
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/util/workqueue"
+)
+
+// testQueue returns a fair queue of items "flow/name", whose classes are set in the returned map
+// and default to update
+func testQueue() (*fairQueue, map[string]int) {
+	classes := map[string]int{}
+	classOf := func(item any) int {
+		if class, ok := classes[item.(string)]; ok {
+			return class
+		}
+		return queueClassUpdate
+	}
+	flowOf := func(item any) string {
+		flow, _, _ := strings.Cut(item.(string), "/")
+		return flow
+	}
+	rateLimiter := workqueue.NewItemExponentialFailureRateLimiter(time.Millisecond, time.Millisecond)
+	return newFairQueue(rateLimiter, classOf, flowOf), classes
+}
+
+// getAll gets and marks as done the items until the queue is empty
+func getAll(t *testing.T, q *fairQueue) []string {
+	t.Helper()
+	items := []string{}
+	for q.Len() > 0 {
+		item, shutdown := q.Get()
+		if shutdown {
+			t.Fatalf("queue shut down with %d items", q.Len())
+		}
+		items = append(items, item.(string))
+		q.Done(item)
+	}
+	return items
+}
+
+func expectItems(t *testing.T, got, expected []string) {
+	t.Helper()
+	if strings.Join(got, ",") != strings.Join(expected, ",") {
+		t.Errorf("got items %v, expected %v", got, expected)
+	}
+}
+
+func TestFairQueueDedup(t *testing.T) {
+	q, _ := testQueue()
+	q.Add("pods/a")
+	q.Add("pods/a")
+	if q.Len() != 1 {
+		t.Fatalf("got length %d, expected 1", q.Len())
+	}
+
+	item, _ := q.Get()
+	// an item added while processed is queued once, when done
+	q.Add("pods/a")
+	q.Add("pods/a")
+	if q.Len() != 0 {
+		t.Fatalf("got length %d while processing, expected 0", q.Len())
+	}
+	queued, processing, _ := q.entries()
+	if len(queued) != 0 || len(processing) != 1 {
+		t.Fatalf("got %d queued and %d processing entries, expected 0 and 1", len(queued), len(processing))
+	}
+	q.Done(item)
+	if q.Len() != 1 {
+		t.Fatalf("got length %d after done, expected 1", q.Len())
+	}
+	expectItems(t, getAll(t, q), []string{"pods/a"})
+}
+
+func TestFairQueueClassPriority(t *testing.T) {
+	q, classes := testQueue()
+	classes["pods/create"] = queueClassCreate
+	classes["pods/delete"] = queueClassDelete
+	q.Add("pods/update")
+	q.Add("pods/create")
+	q.Add("pods/delete")
+	expectItems(t, getAll(t, q), []string{"pods/delete", "pods/create", "pods/update"})
+
+	// a queued item moves to a class of higher priority, and is not moved back to a lower one
+	q.Add("pods/a")
+	q.Add("pods/b")
+	classes["pods/b"] = queueClassDelete
+	q.Add("pods/b")
+	classes["pods/b"] = queueClassUpdate
+	q.Add("pods/b")
+	expectItems(t, getAll(t, q), []string{"pods/b", "pods/a"})
+}
+
+func TestFairQueueUpdateShare(t *testing.T) {
+	q, classes := testQueue()
+	creates := []string{}
+	for i := 0; i < 8; i++ {
+		item := fmt.Sprintf("pods/create-%d", i)
+		classes[item] = queueClassCreate
+		creates = append(creates, item)
+		q.Add(item)
+	}
+	q.Add("pods/update-0")
+	q.Add("pods/update-1")
+	// the 5th and the 10th gets serve the updates first
+	expected := append(append(append(append([]string{}, creates[:4]...), "pods/update-0"), creates[4:]...), "pods/update-1")
+	expectItems(t, getAll(t, q), expected)
+}
+
+func TestFairQueueRoundRobin(t *testing.T) {
+	q, _ := testQueue()
+	for _, item := range []string{"pods/a", "pods/b", "pods/c", "jobs/a", "services/a", "services/b"} {
+		q.Add(item)
+	}
+	expectItems(t, getAll(t, q), []string{"pods/a", "jobs/a", "services/a", "pods/b", "services/b", "pods/c"})
+}
+
+func TestFairQueueAddAfter(t *testing.T) {
+	q, _ := testQueue()
+	// an item waiting to be added is added at the earliest of the requested times
+	q.AddAfter("pods/a", time.Hour)
+	q.AddAfter("pods/a", 100*time.Millisecond)
+	q.AddAfter("pods/a", time.Hour)
+	_, _, waiting := q.entries()
+	if len(waiting) != 1 || time.Until(waiting[0].readyAt) > time.Minute {
+		t.Fatalf("got waiting entries %v, expected pods/a within 100ms", waiting)
+	}
+	item, shutdown := q.Get()
+	if shutdown || item != "pods/a" {
+		t.Fatalf("got item %v and shutdown %t, expected pods/a", item, shutdown)
+	}
+	q.Done(item)
+	if _, _, waiting := q.entries(); len(waiting) != 0 {
+		t.Errorf("got waiting entries %v after the delay, expected none", waiting)
+	}
+
+	q.AddAfter("pods/b", 0)
+	if q.Len() != 1 {
+		t.Errorf("got length %d after adding with no delay, expected 1", q.Len())
+	}
+}
+
+func TestFairQueueForget(t *testing.T) {
+	q, _ := testQueue()
+	q.AddRateLimited("pods/a")
+	q.AddRateLimited("pods/a")
+	if requeues := q.NumRequeues("pods/a"); requeues != 2 {
+		t.Fatalf("got %d requeues, expected 2", requeues)
+	}
+	item, _ := q.Get()
+	q.Done(item)
+	q.Forget(item)
+	if requeues := q.NumRequeues("pods/a"); requeues != 0 {
+		t.Errorf("got %d requeues after forget, expected 0", requeues)
+	}
+}
+
+func TestFairQueueShutDownWithDrain(t *testing.T) {
+	q, _ := testQueue()
+	q.Add("pods/a")
+	q.Add("pods/b")
+	q.AddAfter("pods/c", time.Hour)
+	item, _ := q.Get()
+
+	drained := make(chan struct{})
+	go func() {
+		q.ShutDownWithDrain()
+		close(drained)
+	}()
+	for !q.ShuttingDown() {
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case <-drained:
+		t.Fatal("drained while an item is processed")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// no item is added once shutting down, and the waiting items are dropped
+	q.Add("pods/d")
+	if _, _, waiting := q.entries(); len(waiting) != 0 {
+		t.Errorf("got waiting entries %v while shutting down, expected none", waiting)
+	}
+	q.Done(item)
+	select {
+	case <-drained:
+	case <-time.After(10 * time.Second):
+		t.Fatal("not drained once the processed item is done")
+	}
+
+	// the queued items can still be processed, then the workers are told to stop
+	expectItems(t, getAll(t, q), []string{"pods/b"})
+	if _, shutdown := q.Get(); !shutdown {
+		t.Error("got an item from an empty queue shut down")
+	}
+}
@@ -0,0 +1,126 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/cache"
+	addonv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+	workv1 "open-cluster-management.io/api/work/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrlm "sigs.k8s.io/controller-runtime/pkg/manager"
+
+	"github.com/kubestellar/ocm-status-addon/pkg/util"
+)
+
+// The agent is ready when the caches of the AppliedManifestWorks and of the tracked objects have
+// synced and the hub answered recently, and it is live as long as the work queue makes progress.
+// The deployment of the agent has a readiness probe, so that the availability of the ManagedClusterAddOn,
+// which is based on the ready replicas of the deployment, tells whether the agent is reporting statuses.
+// An unreachable hub only makes the agent not ready, since restarting the agent would not help.
+
+const (
+	// time after the last successful request to the hub after which the agent is not ready
+	hubContactTimeout = 2 * time.Minute
+
+	// interval of the requests made to the hub when no other request succeeded
+	hubHeartbeatInterval = 30 * time.Second
+
+	// time for which the work queue can have queued items without any of them being picked up
+	// by a worker, longer than the timeout of the handling of an object
+	queueStallTimeout = 5 * time.Minute
+)
+
+// hubContact records the time of the last successful round-trip to the hub
+type hubContact struct {
+	lastSuccess atomic.Int64
+}
+
+func (h *hubContact) record() {
+	h.lastSuccess.Store(time.Now().UnixNano())
+}
+
+// since returns the time elapsed since the last successful round-trip, or false if there was none
+func (h *hubContact) since() (time.Duration, bool) {
+	last := h.lastSuccess.Load()
+	if last == 0 {
+		return 0, false
+	}
+	return time.Since(time.Unix(0, last)), true
+}
+
+// AddHealthChecks adds the readiness and liveness checks of the agent to the manager
+func (a *Agent) AddHealthChecks(mgr ctrlm.Manager) error {
+	readyChecks := map[string]func(*http.Request) error{
+		"appliedmanifestwork-synced": a.checkAppliedManifestWorkSynced,
+		"informers-synced":           a.checkInformersSynced,
+		"hub-contact":                a.checkHubContact,
+	}
+	for name, check := range readyChecks {
+		if err := mgr.AddReadyzCheck(name, check); err != nil {
+			return err
+		}
+	}
+	return mgr.AddHealthzCheck("queue-progress", a.checkQueueProgress)
+}
+
+func (a *Agent) checkAppliedManifestWorkSynced(_ *http.Request) error {
+	gvkKey := util.KeyForGroupVersionKind(workv1.GroupVersion.Group, workv1.GroupVersion.Version, util.AppliedManifestWorkKind)
+	informer, ok := a.informers.Get(gvkKey)
+	if !ok || !informer.(cache.SharedIndexInformer).HasSynced() {
+		return fmt.Errorf("appliedmanifestwork cache has not synced")
+	}
+	return nil
+}
+
+// checkInformersSynced checks the informers of the tracked kinds, except the ones the agent is not
+// permitted to watch, which are reported with a condition of the ManagedClusterAddOn
+func (a *Agent) checkInformersSynced(_ *http.Request) error {
+	notSynced := 0
+	for _, informerIntf := range a.informers.ListValues() {
+		informer := informerIntf.(cache.SharedIndexInformer)
+		if !informer.HasSynced() && !a.hasForbiddenInformer(informer) {
+			notSynced++
+		}
+	}
+	if notSynced > 0 {
+		return fmt.Errorf("%d informers have not synced", notSynced)
+	}
+	return nil
+}
+
+func (a *Agent) checkHubContact(_ *http.Request) error {
+	since, ok := a.hubContact.since()
+	if !ok {
+		return fmt.Errorf("no successful request to the hub yet")
+	}
+	if since > hubContactTimeout {
+		return fmt.Errorf("no successful request to the hub for %s", since.Round(time.Second))
+	}
+	return nil
+}
+
+func (a *Agent) checkQueueProgress(_ *http.Request) error {
+	if stalled := a.workqueue.stalledFor(); stalled > queueStallTimeout {
+		return fmt.Errorf("no item picked up from the work queue for %s", stalled.Round(time.Second))
+	}
+	return nil
+}
+
+// runHubHeartbeat reads the ManagedClusterAddOn of the agent when no request to the hub succeeded
+// recently, so that an idle agent can tell whether the hub is reachable.
+func (a *Agent) runHubHeartbeat(ctx context.Context) {
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if since, ok := a.hubContact.since(); ok && since < hubHeartbeatInterval {
+			return
+		}
+		addon := &addonv1alpha1.ManagedClusterAddOn{}
+		if err := a.hubClient.Get(ctx, client.ObjectKey{Namespace: a.clusterName, Name: a.agentName}, addon); err != nil {
+			a.logger.Error(err, "could not reach the hub")
+		}
+	}, hubHeartbeatInterval)
+}
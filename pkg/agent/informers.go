@@ -1,10 +1,13 @@
 package agent
 
 import (
+	"context"
 	"time"
 
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/metadata/metadatainformer"
 	"k8s.io/client-go/tools/cache"
 	workv1 "open-cluster-management.io/api/work/v1"
 
@@ -25,13 +28,34 @@ func (a *Agent) startAppliedManifestWorkInformer(stopper chan struct{}) {
 	a.startInformer(gvr, gvk, stopper, false)
 }
 
+// startManifestWorkInformer starts the informer for the ManifestWorks in the cluster namespace
+// on the hub and returns the function to check if its cache has synced.
+func (a *Agent) startManifestWorkInformer(stopper chan struct{}) cache.InformerSynced {
+	informer := a.hubWorkInformerFactory.Work().V1().ManifestWorks().Informer()
+	a.manifestWorkLister = a.hubWorkInformerFactory.Work().V1().ManifestWorks().Lister()
+
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(old, new interface{}) {
+			if shouldSkipManifestWorkUpdate(old, new) {
+				return
+			}
+			a.handleManifestWork(new)
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if manifestWork, ok := obj.(*workv1.ManifestWork); ok {
+				a.manifestWorkEligibility.Delete(manifestWork.Name)
+			}
+		},
+	})
+
+	a.hubWorkInformerFactory.Start(stopper)
+	return informer.HasSynced
+}
+
 func (a *Agent) startInformers(gvrs []*schema.GroupVersionResource, uids []string) {
-	// update the restmapper
-	var err error
-	a.restMapper, err = getRestMapper(a.managedKubernetesClient)
-	if err != nil {
-		a.logger.Error(err, "could not update restMapper")
-	}
 	for i, gvr := range gvrs {
 
 		gvk, err := a.restMapper.KindFor(*gvr)
@@ -40,8 +64,8 @@ func (a *Agent) startInformers(gvrs []*schema.GroupVersionResource, uids []strin
 			return
 		}
 
-		// we do not need to start informers for objects that do not have status
-		if _, ok := excludedGVKs[gvk.String()]; ok {
+		// we do not need to start informers for objects that are not tracked
+		if !a.trackingRules.Load().TracksGroupKind(gvk.GroupKind()) {
 			continue
 		}
 
@@ -67,11 +91,26 @@ func (a *Agent) startInformer(gvr schema.GroupVersionResource, gvk schema.GroupV
 	// Once a SharedIndexInformer is started, it’s intended to run for the lifetime
 	// of the controller process. The only way to make it restartable is to recreate
 	// the factory
-	managedDynamicFactory := a.managedDynamicFactory
-	if restartable {
-		managedDynamicFactory = dynamicinformer.NewDynamicSharedInformerFactory(a.managedDynamicClient, 0*time.Minute)
+	var informer cache.SharedIndexInformer
+	var transform cache.TransformFunc
+	if a.cacheTransforms {
+		transform = newObjectTransform(restartable)
+	}
+	switch {
+	case restartable && a.isMetadataOnly(gvk.GroupKind()):
+		informer = metadatainformer.NewSharedInformerFactory(a.managedMetadataClient, 0*time.Minute).ForResource(gvr).Informer()
+		transform = newMetadataTransform(gvk)
+	case restartable:
+		informer = dynamicinformer.NewDynamicSharedInformerFactory(a.managedDynamicClient, 0*time.Minute).ForResource(gvr).Informer()
+	default:
+		informer = a.managedDynamicFactory.ForResource(gvr).Informer()
+	}
+	// drop the parts of the objects never read before they are cached
+	if transform != nil {
+		if err := informer.SetTransform(transform); err != nil {
+			a.logger.Error(err, "could not set transform", "key", key)
+		}
 	}
-	informer := managedDynamicFactory.ForResource(gvr).Informer()
 	a.informers.Set(key, informer)
 
 	// add the event handler functions
@@ -95,11 +134,40 @@ func (a *Agent) startInformer(gvr schema.GroupVersionResource, gvk schema.GroupV
 	lister := cache.NewGenericLister(informer.GetIndexer(), gvr.GroupResource())
 	a.listers.Set(key, lister)
 
+	// report the kinds that cannot be watched because of RBAC
+	if err := informer.SetWatchErrorHandlerWithContext(a.newWatchErrorHandler(key)); err != nil {
+		a.logger.Error(err, "could not set watch error handler", "key", key)
+	}
+
 	// run the informer
 	a.stoppers.Set(key, stopper)
 	go informer.Run(stopper)
 }
 
+// waitForInformersSynced waits for the informers started so far to sync, except the ones
+// for kinds the agent is not permitted to watch, which would never sync.
+func (a *Agent) waitForInformersSynced(ctx context.Context) error {
+	return wait.PollUntilContextCancel(ctx, 100*time.Millisecond, true, func(context.Context) (bool, error) {
+		for _, informerIntf := range a.informers.ListValues() {
+			informer := informerIntf.(cache.SharedIndexInformer)
+			if !informer.HasSynced() && !a.hasForbiddenInformer(informer) {
+				return false, nil
+			}
+		}
+		return true, nil
+	})
+}
+
+// hasForbiddenInformer returns true if an informer is for a kind the agent is not permitted to watch
+func (a *Agent) hasForbiddenInformer(informer cache.SharedIndexInformer) bool {
+	for _, key := range a.forbiddenKinds.list() {
+		if forbidden, ok := a.informers.Get(key); ok && forbidden == informer {
+			return true
+		}
+	}
+	return false
+}
+
 func (a *Agent) stopInformers(appliedManifestInfo util.AppliedManifestInfo) {
 	for i, gvr := range appliedManifestInfo.GVRs {
 
@@ -123,12 +191,6 @@ func (a *Agent) stopInformers(appliedManifestInfo util.AppliedManifestInfo) {
 			a.stopInformer(key)
 		}
 	}
-	// update the restmapper
-	var err error
-	a.restMapper, err = getRestMapper(a.managedKubernetesClient)
-	if err != nil {
-		a.logger.Error(err, "could not update restMapper")
-	}
 }
 
 func (a *Agent) stopInformer(key string) {
@@ -143,4 +205,5 @@ func (a *Agent) stopInformer(key string) {
 	a.informers.Delete(key)
 	a.listers.Delete(key)
 	a.stoppers.Delete(key)
+	a.forbiddenKinds.forget(key)
 }
@@ -19,6 +19,7 @@ package agent
 import (
 	"context"
 	"os"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
@@ -35,13 +36,14 @@ import (
 	"k8s.io/client-go/tools/clientcmd"
 	cmdfactory "open-cluster-management.io/addon-framework/pkg/cmd/factory"
 	ctrl "sigs.k8s.io/controller-runtime"
-	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	crmetrics "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 	crwebhook "sigs.k8s.io/controller-runtime/pkg/webhook"
 
 	v1alpha1 "github.com/kubestellar/ocm-status-addon/api/v1alpha1"
 	clientopts "github.com/kubestellar/ocm-status-addon/pkg/client-options"
 	"github.com/kubestellar/ocm-status-addon/pkg/observability"
+	"github.com/kubestellar/ocm-status-addon/pkg/redaction"
+	"github.com/kubestellar/ocm-status-addon/pkg/tracking"
 )
 
 var (
@@ -86,8 +88,50 @@ type AgentOptions struct {
 }
 
 type AgentUserOptions struct {
-	LocalLimits clientopts.ClientLimits[*pflag.FlagSet]
-	HubLimits   clientopts.ClientLimits[*pflag.FlagSet]
+	LocalLimits       clientopts.ClientLimits[*pflag.FlagSet]
+	HubLimits         clientopts.ClientLimits[*pflag.FlagSet]
+	AntiEntropyPeriod time.Duration
+	TrackingInclude   string
+	TrackingExclude   string
+	TrackingRulesFile string
+	MetadataOnlyKinds string
+	// whether the parts of the objects never read are dropped before caching them
+	CacheTransforms      bool
+	StatusProjectionFile string
+	// redaction of sensitive values in the reported statuses
+	StatusRedactionFile string
+	RedactionKeys       string
+	RedactionSaltFile   string
+	// size budget of the reported statuses, and whether to compress the statuses above it
+	MaxStatusSize           int
+	CompressOversizedStatus bool
+	// minimum interval between the updates of the WorkStatus of an object, with per-kind overrides
+	MinReportInterval          time.Duration
+	MinReportIntervalOverrides string
+	// hash of the hub in the AppliedManifestWorks, computed from the hub kubeconfig if empty
+	HubHash string
+	// selection of the ManifestWorks whose objects are reported
+	ManifestWorkLabelPrefixes      string
+	ManifestWorkLabelSelector      string
+	ManifestWorkAnnotationSelector string
+}
+
+// TrackingRules returns the tracking rules set by flags
+func (o *AgentUserOptions) TrackingRules() (tracking.Rules, error) {
+	include, err := tracking.ParseRules(o.TrackingInclude)
+	if err != nil {
+		return tracking.Rules{}, err
+	}
+	exclude, err := tracking.ParseRules(o.TrackingExclude)
+	if err != nil {
+		return tracking.Rules{}, err
+	}
+	return tracking.Rules{Include: include, Exclude: exclude}, nil
+}
+
+// ManifestWorkSelector returns the selector of the ManifestWorks whose objects are reported
+func (o *AgentUserOptions) ManifestWorkSelector() (tracking.ManifestWorkSelector, error) {
+	return tracking.ParseManifestWorkSelector(o.ManifestWorkLabelPrefixes, o.ManifestWorkLabelSelector, o.ManifestWorkAnnotationSelector)
 }
 
 // NewAgentOptions returns the flags with default value set
@@ -100,21 +144,30 @@ func NewAgentOptions(addonName string) *AgentOptions {
 
 func NewObservabilityOptions() observability.ObservabilityOptions[*pflag.FlagSet] {
 	return observability.ObservabilityOptions[*pflag.FlagSet]{
-		MetricsBindAddr: ":8080",
-		PprofBindAddr:   ":8082",
+		MetricsBindAddr:      ":8080",
+		PprofBindAddr:        ":8082",
+		TracingSamplingRatio: 0.1,
 	}
 }
 
 func NewAgentUserOptions() AgentUserOptions {
 	return AgentUserOptions{
-		LocalLimits: clientopts.NewClientLimits[*pflag.FlagSet]("local", "accessing the local cluster"),
-		HubLimits:   clientopts.NewClientLimits[*pflag.FlagSet]("hub", "accessing the hub"),
+		LocalLimits:       clientopts.NewClientLimits[*pflag.FlagSet]("local", "accessing the local cluster"),
+		HubLimits:         clientopts.NewClientLimits[*pflag.FlagSet]("hub", "accessing the hub"),
+		AntiEntropyPeriod: 10 * time.Minute,
+		TrackingExclude:   tracking.DefaultExclude,
+		CacheTransforms:   true,
+		RedactionKeys:     redaction.DefaultKeys,
+		MaxStatusSize:     512 * 1024,
+
+		ManifestWorkLabelPrefixes: ManagedByKSLabelKeyPrefix + "," + TransportLabelPrefix,
 	}
 }
 
 func (o *AgentOptions) AddFlags(cmd *cobra.Command) {
 	flags := cmd.PersistentFlags()
 	o.ObservabilityOptions.AddToFlagSet(flags)
+	o.ObservabilityOptions.AddTracingToFlagSet(flags)
 	// This command only supports reading from config
 	flags.StringVar(&o.HubKubeconfigFile, "hub-kubeconfig", o.HubKubeconfigFile,
 		"Location of kubeconfig file to connect to hub cluster.")
@@ -131,11 +184,59 @@ func (o *AgentOptions) AddFlags(cmd *cobra.Command) {
 func (o *AgentUserOptions) AddToFlagSet(flags *pflag.FlagSet) {
 	o.LocalLimits.AddToFlagSet(flags)
 	o.HubLimits.AddToFlagSet(flags)
+	flags.DurationVar(&o.AntiEntropyPeriod, "anti-entropy-period", o.AntiEntropyPeriod,
+		"Period of the reconciliation between the tracked objects and the WorkStatuses on the hub, 0 to run it only at startup")
+	flags.StringVar(&o.TrackingInclude, "tracking-include", o.TrackingInclude,
+		"Comma separated rules group/kind[@namespace[;namespace...]] for the objects to track, with glob patterns; empty to include all objects")
+	flags.StringVar(&o.TrackingExclude, "tracking-exclude", o.TrackingExclude,
+		"Comma separated rules group/kind[@namespace[;namespace...]] for the objects not to track, with glob patterns; the core group is empty")
+	flags.StringVar(&o.TrackingRulesFile, "tracking-rules-file", o.TrackingRulesFile,
+		"Path to an optional YAML file with include and exclude rules added to the ones set by flags, reloaded when changed")
+	flags.StringVar(&o.MetadataOnlyKinds, "metadata-only-kinds", o.MetadataOnlyKinds,
+		"Comma separated rules group/kind for the kinds watched with metadata-only informers, with glob patterns; the objects reported are read when their metadata changes")
+	flags.BoolVar(&o.CacheTransforms, "cache-transforms", o.CacheTransforms,
+		"Drop the managed fields, the last applied configuration and the unreported parts of the objects before caching them; disabled only to measure the memory they save")
+	flags.StringVar(&o.StatusProjectionFile, "status-projection-file", o.StatusProjectionFile,
+		"Path to an optional YAML file with the status fields reported for selected kinds, reloaded when changed")
+	flags.StringVar(&o.StatusRedactionFile, "status-redaction-file", o.StatusRedactionFile,
+		"Path to an optional YAML file with rules for the status values to remove or hash before reporting them, reloaded when changed")
+	flags.StringVar(&o.RedactionKeys, "redaction-keys", o.RedactionKeys,
+		"Comma separated glob patterns of the keys whose values are redacted in all reported statuses, matched regardless of case; empty for none")
+	flags.StringVar(&o.RedactionSaltFile, "redaction-salt-file", o.RedactionSaltFile,
+		"Path to an optional file with the salt of the hashes of redacted values; when it does not exist, the values to hash are removed instead")
+	flags.IntVar(&o.MaxStatusSize, "max-status-size", o.MaxStatusSize,
+		"Size budget in bytes of the reported status of an object, 0 for no budget; larger statuses are shrunk and marked as truncated")
+	flags.BoolVar(&o.CompressOversizedStatus, "compress-oversized-status", o.CompressOversizedStatus,
+		"Compress the statuses that still exceed the size budget after dropping their largest lists, instead of keeping only their conditions")
+	flags.StringVar(&o.ManifestWorkLabelPrefixes, "manifestwork-label-prefixes", o.ManifestWorkLabelPrefixes,
+		"Comma separated prefixes of label keys; the objects of a ManifestWork with a label key starting with one of them are reported")
+	flags.StringVar(&o.ManifestWorkLabelSelector, "manifestwork-label-selector", o.ManifestWorkLabelSelector,
+		"Label selector of additional ManifestWorks whose objects are reported")
+	flags.StringVar(&o.ManifestWorkAnnotationSelector, "manifestwork-annotation-selector", o.ManifestWorkAnnotationSelector,
+		"Selector in the syntax of label selectors applied to the annotations of additional ManifestWorks whose objects are reported; "+
+			"the objects of all ManifestWorks are reported when no prefixes and no selectors are set")
+	flags.StringVar(&o.HubHash, "hub-hash", o.HubHash,
+		"Hash of the hub in the spec.hubHash of the AppliedManifestWorks to report, computed from the server of the hub kubeconfig if empty; the AppliedManifestWorks of other hubs are ignored")
+	flags.DurationVar(&o.MinReportInterval, "min-report-interval", o.MinReportInterval,
+		"Minimum interval between the updates of the WorkStatus of an object, 0 for no minimum; updates with a condition transition are not delayed")
+	flags.StringVar(&o.MinReportIntervalOverrides, "min-report-interval-overrides", o.MinReportIntervalOverrides,
+		"Comma separated group/kind=duration overrides of the minimum report interval, with glob patterns; the first matching override applies")
 }
 
 func (o *AgentOptions) RunAgent(ctx context.Context, kubeconfig *rest.Config) error {
 	ctrl.SetLogger(klog.FromContext(ctx))
 
+	shutdownTracing, err := o.ObservabilityOptions.StartTracing(ctx, "status-addon-agent")
+	if err != nil {
+		setupLog.Error(err, "unable to set up tracing")
+		os.Exit(1)
+	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			setupLog.Error(err, "problem flushing traces")
+		}
+	}()
+
 	// setup manager
 	// manager here is mainly used for leader election and health checks
 	managedConfig := ctrl.GetConfigOrDie()
@@ -164,15 +265,6 @@ func (o *AgentOptions) RunAgent(ctx context.Context, kubeconfig *rest.Config) er
 		setupLog.Error(err, "unable to create manager")
 		os.Exit(1)
 	}
-	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
-		setupLog.Error(err, "unable to set up health check")
-		os.Exit(1)
-	}
-	if err := mgr.AddReadyzCheck("readyz", healthz.Ping); err != nil {
-		setupLog.Error(err, "unable to set up ready check")
-		os.Exit(1)
-	}
-
 	// get the rest config for hub
 	hubConfig, err := clientcmd.BuildConfigFromFlags("", o.HubKubeconfigFile)
 	if err != nil {
@@ -182,11 +274,19 @@ func (o *AgentOptions) RunAgent(ctx context.Context, kubeconfig *rest.Config) er
 	hubConfig = o.HubLimits.LimitConfig(hubConfig)
 
 	// start the agent
-	agent, err := NewAgent(mgr, managedConfig, hubConfig, o.SpokeClusterName, o.AddonName)
+	agent, err := NewAgent(mgr, managedConfig, hubConfig, o.SpokeClusterName, o.AddonName, o.AgentUserOptions)
 	if err != nil {
 		setupLog.Error(err, "unable to create add-on agent", "controller", "agent")
 		os.Exit(1)
 	}
+	if err := agent.AddHealthChecks(mgr); err != nil {
+		setupLog.Error(err, "unable to set up health and ready checks")
+		os.Exit(1)
+	}
+	if err := agent.AddDebugHandler(mgr); err != nil {
+		setupLog.Error(err, "unable to set up debug endpoint")
+		os.Exit(1)
+	}
 
 	if err := agent.Start(workers); err != nil {
 		setupLog.Error(err, "error starting the agent controller", "controller", "agent")
@@ -0,0 +1,182 @@
+package agent
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// metrics of the agent are registered with the controller-runtime registry,
+// which is served by the metrics server of the agent manager.
+const metricsSubsystem = "status_agent"
+
+// outcomes of the reconciliation of an object
+const (
+	outcomeCreate = "create"
+	outcomeUpdate = "update"
+	outcomeDelete = "delete"
+	// no write to the hub was needed, e.g. the WorkStatus is up to date or the object is not reported
+	outcomeSkip = "skip"
+	// the update of the WorkStatus is deferred to the end of the minimum report interval
+	outcomeDefer = "defer"
+	outcomeError = "error"
+)
+
+// actions of the anti-entropy reconciler on WorkStatuses
+const (
+	repairCreate  = "create"
+	repairRefresh = "refresh"
+	repairDelete  = "delete"
+)
+
+var (
+	workStatusWritesSkipped = prometheus.NewCounter(prometheus.CounterOpts{
+		Subsystem: metricsSubsystem,
+		Name:      "workstatus_writes_skipped_total",
+		Help:      "Number of WorkStatus writes to the hub skipped because the content did not change since the last write.",
+	})
+
+	workStatusUpdatesDeferred = prometheus.NewCounter(prometheus.CounterOpts{
+		Subsystem: metricsSubsystem,
+		Name:      "workstatus_updates_deferred_total",
+		Help:      "Number of WorkStatus updates deferred to the end of the minimum report interval of the object.",
+	})
+
+	statusTruncations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: metricsSubsystem,
+		Name:      "status_truncations_total",
+		Help:      "Number of reported statuses shrunk to fit the size budget, by last shrinking step.",
+	}, []string{"step"})
+
+	workStatusRepairs = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: metricsSubsystem,
+		Name:      "workstatus_repairs_total",
+		Help:      "Number of WorkStatuses repaired by the anti-entropy reconciler, by action.",
+	}, []string{"action"})
+
+	reconcileDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Subsystem: metricsSubsystem,
+		Name:      "reconcile_duration_seconds",
+		Help:      "Duration of the reconciliations of objects, by group/version/kind of the object and outcome.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 2, 15),
+	}, []string{"gvk", "outcome"})
+
+	reconcileErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: metricsSubsystem,
+		Name:      "reconcile_errors_total",
+		Help:      "Number of reconciliations of objects that failed, by group/version/kind of the object.",
+	}, []string{"gvk"})
+
+	hubRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: metricsSubsystem,
+		Name:      "hub_requests_total",
+		Help:      "Number of requests made by the agent to the hub API server, by method and status code.",
+	}, []string{"method", "code"})
+
+	queueDepth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Subsystem: metricsSubsystem,
+		Name:      "queue_depth",
+		Help:      "Number of items waiting in the work queue, by class (delete, create or update).",
+	}, []string{"class"})
+
+	queueAdds = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: metricsSubsystem,
+		Name:      "queue_adds_total",
+		Help:      "Number of items added to the work queue, by class.",
+	}, []string{"class"})
+
+	queueDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Subsystem: metricsSubsystem,
+		Name:      "queue_duration_seconds",
+		Help:      "Time items stay in the work queue before being processed, by class.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 2, 15),
+	}, []string{"class"})
+
+	queueRetries = prometheus.NewCounter(prometheus.CounterOpts{
+		Subsystem: metricsSubsystem,
+		Name:      "queue_retries_total",
+		Help:      "Number of items requeued with rate limiting.",
+	})
+
+	runningInformersDesc = prometheus.NewDesc(
+		prometheus.BuildFQName("", metricsSubsystem, "running_informers"),
+		"Number of informers running on the managed cluster.",
+		nil, nil)
+
+	trackedObjectsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName("", metricsSubsystem, "tracked_objects"),
+		"Number of objects tracked on the managed cluster, by group/version/kind.",
+		[]string{"gvk"}, nil)
+
+	forbiddenKindsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName("", metricsSubsystem, "forbidden_kinds"),
+		"Number of tracked kinds the agent is not permitted to watch on the managed cluster.",
+		nil, nil)
+)
+
+func init() {
+	ctrlmetrics.Registry.MustRegister(
+		workStatusWritesSkipped,
+		workStatusUpdatesDeferred,
+		statusTruncations,
+		workStatusRepairs,
+		reconcileDuration,
+		reconcileErrors,
+		hubRequests,
+		queueDepth,
+		queueAdds,
+		queueDuration,
+		queueRetries,
+	)
+}
+
+// observeReconcile records the duration and the outcome of the reconciliation of an object
+func observeReconcile(gvkKey, outcome string, start time.Time, err error) {
+	if err != nil {
+		outcome = outcomeError
+		reconcileErrors.WithLabelValues(gvkKey).Inc()
+	}
+	reconcileDuration.WithLabelValues(gvkKey, outcome).Observe(time.Since(start).Seconds())
+}
+
+// trackingCollector reports the informers and the tracked objects of an agent when collected
+type trackingCollector struct {
+	agent *Agent
+}
+
+func (c trackingCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- runningInformersDesc
+	ch <- trackedObjectsDesc
+	ch <- forbiddenKindsDesc
+}
+
+func (c trackingCollector) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(runningInformersDesc, prometheus.GaugeValue, float64(c.agent.informers.Len()))
+	ch <- prometheus.MustNewConstMetric(forbiddenKindsDesc, prometheus.GaugeValue, float64(len(c.agent.forbiddenKinds.list())))
+	for gvkKey, count := range c.agent.objectsCount.GetUIDCounts() {
+		ch <- prometheus.MustNewConstMetric(trackedObjectsDesc, prometheus.GaugeValue, float64(count), gvkKey)
+	}
+}
+
+// hubRequestsRoundTripper counts the requests made to the hub, and records the successful ones
+// for the readiness of the agent
+type hubRequestsRoundTripper struct {
+	delegate http.RoundTripper
+	contact  *hubContact
+}
+
+func (rt hubRequestsRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := rt.delegate.RoundTrip(req)
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(resp.StatusCode)
+		if resp.StatusCode < http.StatusInternalServerError {
+			rt.contact.record()
+		}
+	}
+	hubRequests.WithLabelValues(req.Method, code).Inc()
+	return resp, err
+}
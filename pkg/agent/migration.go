@@ -0,0 +1,49 @@
+package agent
+
+import (
+	"context"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/kubestellar/ocm-status-addon/api/v1alpha1"
+)
+
+// Previous versions named the WorkStatuses by joining the identity of their object and truncating
+// the result, which could collide for long names. A WorkStatus with a legacy name is migrated by
+// writing the WorkStatus with the current name, with the status details of the legacy one, and
+// only then deleting the legacy one.
+
+// deleteLegacyWorkStatus deletes the WorkStatus with the legacy name of an object, if it exists
+func (a *Agent) deleteLegacyWorkStatus(ctx context.Context, legacyName string) error {
+	workStatus := &v1alpha1.WorkStatus{}
+	workStatus.Namespace = a.clusterName
+	workStatus.Name = legacyName
+	if err := a.hubClient.Delete(ctx, workStatus, &client.DeleteOptions{}); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	a.writtenStatuses.Delete(legacyName)
+	a.logger.Info("workStatus with legacy name deleted", "workStatus-name", legacyName)
+	return nil
+}
+
+// setSourceIdentityLabels sets the labels with the identity of the object of a WorkStatus,
+// leaving out the empty values and the ones that are not valid label values
+func setSourceIdentityLabels(labels map[string]string, gvk schema.GroupVersionKind, namespace, name string) {
+	for key, value := range map[string]string{
+		SourceGroupLabelKey:     gvk.Group,
+		SourceVersionLabelKey:   gvk.Version,
+		SourceKindLabelKey:      gvk.Kind,
+		SourceNamespaceLabelKey: namespace,
+		SourceNameLabelKey:      name,
+	} {
+		if value != "" && len(validation.IsValidLabelValue(value)) == 0 {
+			labels[key] = value
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package agent
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/kubestellar/ocm-status-addon/api/v1alpha1"
+)
+
+// The status of an object exceeding the size budget is shrunk progressively, as a WorkStatus larger
+// than the request size limit of the hub cannot be written and would be retried forever.
+const (
+	conditionsField = "conditions"
+	compressedField = "compressed"
+)
+
+// steps of the shrinking of an oversized status, the label of the truncation metric
+const (
+	truncationProjection  = "projection"
+	truncationLists       = "lists"
+	truncationCompression = "compression"
+	truncationConditions  = "conditions"
+)
+
+// getStatusToReport returns the status reported for an object with its sensitive values redacted,
+// the number of redacted values, and the truncation of the status when it exceeded the size budget.
+func (a *Agent) getStatusToReport(obj runtime.Object, gk schema.GroupKind) ([]byte, int, *v1alpha1.StatusTruncation, error) {
+	rawStatus, err := a.getReportedStatus(obj)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	rawStatus, redacted, err := a.statusRedactor.Load().Redact(gk, rawStatus)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	if a.maxStatusSize <= 0 || len(rawStatus) <= a.maxStatusSize {
+		return rawStatus, redacted, nil, nil
+	}
+
+	truncation := &v1alpha1.StatusTruncation{OriginalSize: int64(len(rawStatus))}
+	step := truncationProjection
+	if uObj, ok := obj.(*unstructured.Unstructured); ok {
+		projected, found, err := a.statusProjector.Load().ProjectOversized(uObj)
+		if err != nil {
+			return nil, 0, nil, err
+		}
+		if found {
+			if rawStatus, err = json.Marshal(projected); err != nil {
+				return nil, 0, nil, err
+			}
+			if rawStatus, redacted, err = a.statusRedactor.Load().Redact(gk, rawStatus); err != nil {
+				return nil, 0, nil, err
+			}
+			truncation.Projected = true
+		}
+	}
+
+	if len(rawStatus) > a.maxStatusSize {
+		step = truncationLists
+		if rawStatus, truncation.DroppedFields, err = dropLargestLists(rawStatus, a.maxStatusSize); err != nil {
+			return nil, 0, nil, err
+		}
+	}
+
+	if len(rawStatus) > a.maxStatusSize && a.compressOversizedStatus {
+		compressed, err := compressStatus(rawStatus)
+		if err != nil {
+			return nil, 0, nil, err
+		}
+		if len(compressed) <= a.maxStatusSize {
+			step = truncationCompression
+			rawStatus = compressed
+			truncation.Encoding = v1alpha1.StatusEncodingGzip
+		}
+	}
+
+	if len(rawStatus) > a.maxStatusSize {
+		step = truncationConditions
+		var dropped []string
+		if rawStatus, dropped, err = keepConditionsOnly(rawStatus, a.maxStatusSize); err != nil {
+			return nil, 0, nil, err
+		}
+		truncation.DroppedFields = append(truncation.DroppedFields, dropped...)
+	}
+
+	a.logger.V(1).Info("Status exceeds the size budget, reporting a truncated status", "kind", gk,
+		"originalSize", truncation.OriginalSize, "size", len(rawStatus), "step", step)
+	statusTruncations.WithLabelValues(step).Inc()
+	return rawStatus, redacted, truncation, nil
+}
+
+// droppableList is a list of a status that can be dropped, with its parent and its path
+type droppableList struct {
+	parent map[string]any
+	key    string
+	path   string
+	size   int
+}
+
+// dropLargestLists removes the largest lists of a status, other than the conditions, until the
+// status fits in the budget. Returns the status and the paths of the removed lists.
+func dropLargestLists(rawStatus []byte, budget int) ([]byte, []string, error) {
+	var status map[string]any
+	if err := json.Unmarshal(rawStatus, &status); err != nil {
+		// a status that is not an object has no list to drop
+		return rawStatus, nil, nil
+	}
+	dropped := []string{}
+	for len(rawStatus) > budget {
+		largest := largestList(status, ".status", nil)
+		if largest == nil {
+			break
+		}
+		delete(largest.parent, largest.key)
+		dropped = append(dropped, largest.path)
+		var err error
+		if rawStatus, err = json.Marshal(status); err != nil {
+			return nil, nil, err
+		}
+	}
+	return rawStatus, dropped, nil
+}
+
+// largestList returns the largest list in a value other than the conditions, or the given largest
+// list if there is no larger one. The lists within a list are not dropped themselves.
+func largestList(value any, path string, largest *droppableList) *droppableList {
+	switch v := value.(type) {
+	case map[string]any:
+		for _, key := range sortedKeys(v) {
+			if key == conditionsField {
+				continue
+			}
+			childPath := path + "." + key
+			if list, ok := v[key].([]any); ok {
+				data, _ := json.Marshal(list)
+				if largest == nil || len(data) > largest.size {
+					largest = &droppableList{parent: v, key: key, path: childPath, size: len(data)}
+				}
+			}
+			largest = largestList(v[key], childPath, largest)
+		}
+	case []any:
+		for i, element := range v {
+			largest = largestList(element, fmt.Sprintf("%s[%d]", path, i), largest)
+		}
+	}
+	return largest
+}
+
+// compressStatus returns a status holding the conditions of a status and the base64 encoding
+// of the status compressed with gzip
+func compressStatus(rawStatus []byte) ([]byte, error) {
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+	if _, err := writer.Write(rawStatus); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	compressed := map[string]any{compressedField: base64.StdEncoding.EncodeToString(buffer.Bytes())}
+	var status map[string]any
+	if err := json.Unmarshal(rawStatus, &status); err == nil {
+		if conditions, ok := status[conditionsField]; ok {
+			compressed[conditionsField] = conditions
+		}
+	}
+	return json.Marshal(compressed)
+}
+
+// keepConditionsOnly removes all the fields of a status but the conditions, and the conditions as well
+// if they do not fit in the budget. Returns the status and the paths of the removed fields.
+func keepConditionsOnly(rawStatus []byte, budget int) ([]byte, []string, error) {
+	var status map[string]any
+	if err := json.Unmarshal(rawStatus, &status); err != nil {
+		return []byte("{}"), []string{".status"}, nil
+	}
+	dropped := []string{}
+	for _, key := range sortedKeys(status) {
+		if key != conditionsField {
+			delete(status, key)
+			dropped = append(dropped, ".status."+key)
+		}
+	}
+	data, err := json.Marshal(status)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(data) > budget {
+		return []byte("{}"), append(dropped, ".status."+conditionsField), nil
+	}
+	return data, dropped, nil
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,208 @@
+package agent
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testOversizedStatus = `{"addresses":["a","b","c","d"],"conditions":[{"type":"Ready"}],"nested":{"items":[1,2]},"phase":"Running","ports":[1]}`
+
+func TestDropLargestLists(t *testing.T) {
+	withoutAddresses := `{"conditions":[{"type":"Ready"}],"nested":{"items":[1,2]},"phase":"Running","ports":[1]}`
+	withoutLists := `{"conditions":[{"type":"Ready"}],"nested":{},"phase":"Running"}`
+	tests := []struct {
+		name     string
+		status   string
+		budget   int
+		expected string
+		dropped  []string
+	}{
+		{
+			name:     "within the budget",
+			status:   testOversizedStatus,
+			budget:   len(testOversizedStatus),
+			expected: testOversizedStatus,
+			dropped:  []string{},
+		},
+		{
+			name:     "largest list",
+			status:   testOversizedStatus,
+			budget:   len(withoutAddresses),
+			expected: withoutAddresses,
+			dropped:  []string{".status.addresses"},
+		},
+		{
+			name:     "nested lists",
+			status:   testOversizedStatus,
+			budget:   len(withoutLists),
+			expected: withoutLists,
+			dropped:  []string{".status.addresses", ".status.nested.items", ".status.ports"},
+		},
+		{
+			name:     "conditions above the budget",
+			status:   testOversizedStatus,
+			budget:   10,
+			expected: withoutLists,
+			dropped:  []string{".status.addresses", ".status.nested.items", ".status.ports"},
+		},
+		{
+			name:     "lists of the same size",
+			status:   `{"a":[1],"b":[2]}`,
+			budget:   len(`{"b":[2]}`),
+			expected: `{"b":[2]}`,
+			dropped:  []string{".status.a"},
+		},
+		{
+			name:     "list in a list",
+			status:   `{"groups":[{"members":["a","b"]},{"members":["c"]}],"phase":"Running"}`,
+			budget:   len(`{"phase":"Running"}`),
+			expected: `{"phase":"Running"}`,
+			dropped:  []string{".status.groups"},
+		},
+		{
+			name:     "not an object",
+			status:   `"running"`,
+			budget:   1,
+			expected: `"running"`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			status, dropped, err := dropLargestLists([]byte(test.status), test.budget)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(status) != test.expected {
+				t.Errorf("got status %s, expected %s", status, test.expected)
+			}
+			if !reflect.DeepEqual(dropped, test.dropped) {
+				t.Errorf("got dropped fields %v, expected %v", dropped, test.dropped)
+			}
+		})
+	}
+}
+
+func TestCompressStatus(t *testing.T) {
+	addresses := []string{}
+	for i := 0; i < 1000; i++ {
+		addresses = append(addresses, fmt.Sprintf(`"10.0.%d.%d"`, i/250, i%250))
+	}
+	large := `{"addresses":[` + strings.Join(addresses, ",") + `],"conditions":[{"type":"Ready"}]}`
+	tests := []struct {
+		name       string
+		status     string
+		conditions any
+	}{
+		{name: "conditions", status: large, conditions: []any{map[string]any{"type": "Ready"}}},
+		{name: "no conditions", status: `{"phase":"Running"}`},
+		{name: "not an object", status: `"running"`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			compressed, err := compressStatus([]byte(test.status))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var status map[string]any
+			if err := json.Unmarshal(compressed, &status); err != nil {
+				t.Fatalf("got status %s that is not an object: %v", compressed, err)
+			}
+			if !reflect.DeepEqual(status[conditionsField], test.conditions) {
+				t.Errorf("got conditions %v, expected %v", status[conditionsField], test.conditions)
+			}
+			encoded, _ := status[compressedField].(string)
+			data, err := base64.StdEncoding.DecodeString(encoded)
+			if err != nil {
+				t.Fatalf("invalid base64: %v", err)
+			}
+			reader, err := gzip.NewReader(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("invalid gzip: %v", err)
+			}
+			decompressed, err := io.ReadAll(reader)
+			if err != nil {
+				t.Fatalf("invalid gzip: %v", err)
+			}
+			if string(decompressed) != test.status {
+				t.Errorf("got decompressed status %s, expected %s", decompressed, test.status)
+			}
+		})
+	}
+
+	// a repetitive status fits in a budget it exceeded once compressed
+	compressed, err := compressStatus([]byte(large))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if budget := len(large) / 2; len(compressed) > budget {
+		t.Errorf("got a compressed status of %d bytes, expected at most %d", len(compressed), budget)
+	}
+}
+
+func TestKeepConditionsOnly(t *testing.T) {
+	conditionsOnly := `{"conditions":[{"type":"Ready"}]}`
+	tests := []struct {
+		name     string
+		status   string
+		budget   int
+		expected string
+		dropped  []string
+	}{
+		{
+			name:     "conditions within the budget",
+			status:   testOversizedStatus,
+			budget:   len(conditionsOnly),
+			expected: conditionsOnly,
+			dropped:  []string{".status.addresses", ".status.nested", ".status.phase", ".status.ports"},
+		},
+		{
+			name:     "conditions above the budget",
+			status:   testOversizedStatus,
+			budget:   len(conditionsOnly) - 1,
+			expected: `{}`,
+			dropped:  []string{".status.addresses", ".status.nested", ".status.phase", ".status.ports", ".status.conditions"},
+		},
+		{
+			name:     "no conditions",
+			status:   `{"phase":"Running"}`,
+			budget:   10,
+			expected: `{}`,
+			dropped:  []string{".status.phase"},
+		},
+		{
+			name:     "compressed status",
+			status:   `{"compressed":"H4sI","conditions":[{"type":"Ready"}]}`,
+			budget:   len(conditionsOnly),
+			expected: conditionsOnly,
+			dropped:  []string{".status.compressed"},
+		},
+		{
+			name:     "not an object",
+			status:   `"running"`,
+			budget:   100,
+			expected: `{}`,
+			dropped:  []string{".status"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			status, dropped, err := keepConditionsOnly([]byte(test.status), test.budget)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(status) != test.expected {
+				t.Errorf("got status %s, expected %s", status, test.expected)
+			}
+			if !reflect.DeepEqual(dropped, test.dropped) {
+				t.Errorf("got dropped fields %v, expected %v", dropped, test.dropped)
+			}
+		})
+	}
+}
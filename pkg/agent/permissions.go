@@ -0,0 +1,147 @@
+package agent
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/retry"
+	addonv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// The agent is only granted read access to the kinds applied by the ManifestWorks of its cluster,
+// through a ClusterRole maintained by the addon controller. Until that ClusterRole includes a newly
+// applied kind, or when it cannot be updated, the informer for the kind fails with forbidden errors.
+// The kinds that cannot be watched are reported with a condition of the ManagedClusterAddOn.
+
+const (
+	// WatchPermittedConditionType is the condition of the ManagedClusterAddOn reporting whether
+	// the agent is permitted to watch all the kinds it tracks
+	WatchPermittedConditionType = "WatchPermitted"
+
+	watchPermittedReason = "WatchPermitted"
+	watchForbiddenReason = "Forbidden"
+
+	// time after the last forbidden error after which a kind is considered permitted again.
+	// Informers retry failed lists with a backoff capped well below this time.
+	forbiddenKindExpiration = 2 * time.Minute
+
+	// interval for reporting the kinds that cannot be watched
+	permissionsReportInterval = 30 * time.Second
+)
+
+// forbiddenKinds records the kinds that could not be watched because of RBAC, with the time of
+// the last forbidden error
+type forbiddenKinds struct {
+	sync.Mutex
+	lastErrors map[string]time.Time
+}
+
+func newForbiddenKinds() *forbiddenKinds {
+	return &forbiddenKinds{lastErrors: map[string]time.Time{}}
+}
+
+func (f *forbiddenKinds) record(gvkKey string) {
+	f.Lock()
+	defer f.Unlock()
+	f.lastErrors[gvkKey] = time.Now()
+}
+
+func (f *forbiddenKinds) forget(gvkKey string) {
+	f.Lock()
+	defer f.Unlock()
+	delete(f.lastErrors, gvkKey)
+}
+
+func (f *forbiddenKinds) has(gvkKey string) bool {
+	f.Lock()
+	defer f.Unlock()
+	last, ok := f.lastErrors[gvkKey]
+	return ok && time.Since(last) < forbiddenKindExpiration
+}
+
+// list returns the sorted kinds with a forbidden error more recent than the expiration
+func (f *forbiddenKinds) list() []string {
+	f.Lock()
+	defer f.Unlock()
+	result := []string{}
+	for gvkKey, last := range f.lastErrors {
+		if time.Since(last) >= forbiddenKindExpiration {
+			delete(f.lastErrors, gvkKey)
+			continue
+		}
+		result = append(result, gvkKey)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// newWatchErrorHandler returns the watch error handler of the informer for a kind, which records
+// the kind when the list or watch is forbidden before applying the default handling.
+func (a *Agent) newWatchErrorHandler(gvkKey string) cache.WatchErrorHandlerWithContext {
+	return func(ctx context.Context, r *cache.Reflector, err error) {
+		if apierrors.IsForbidden(err) {
+			if !a.forbiddenKinds.has(gvkKey) {
+				a.logger.Error(err, "Agent is not permitted to watch kind, status of its objects is not reported", "key", gvkKey)
+			}
+			a.forbiddenKinds.record(gvkKey)
+		}
+		cache.DefaultWatchErrorHandler(ctx, r, err)
+	}
+}
+
+// runPermissionsReporter periodically reports the kinds that cannot be watched with
+// a condition of the ManagedClusterAddOn of the agent.
+func (a *Agent) runPermissionsReporter(ctx context.Context) {
+	reported := ""
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		condition := watchPermittedCondition(a.forbiddenKinds.list())
+		if condition.Message == reported {
+			return
+		}
+		if err := a.reportCondition(ctx, condition); err != nil {
+			a.logger.Error(err, "could not report condition on managedclusteraddon", "condition", condition.Type)
+			return
+		}
+		reported = condition.Message
+	}, permissionsReportInterval)
+}
+
+// reportCondition sets a condition on the ManagedClusterAddOn of the agent, if not already set.
+func (a *Agent) reportCondition(ctx context.Context, condition metav1.Condition) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		addon := &addonv1alpha1.ManagedClusterAddOn{}
+		if err := a.hubClient.Get(ctx, client.ObjectKey{Namespace: a.clusterName, Name: a.agentName}, addon); err != nil {
+			return err
+		}
+		if !meta.SetStatusCondition(&addon.Status.Conditions, condition) {
+			return nil
+		}
+		return a.hubClient.Status().Update(ctx, addon)
+	})
+}
+
+func watchPermittedCondition(forbidden []string) metav1.Condition {
+	if len(forbidden) == 0 {
+		return metav1.Condition{
+			Type:    WatchPermittedConditionType,
+			Status:  metav1.ConditionTrue,
+			Reason:  watchPermittedReason,
+			Message: "The agent is permitted to watch all the tracked kinds",
+		}
+	}
+	return metav1.Condition{
+		Type:    WatchPermittedConditionType,
+		Status:  metav1.ConditionFalse,
+		Reason:  watchForbiddenReason,
+		Message: "The agent is not permitted to watch the kinds " + strings.Join(forbidden, ", ") + ", the status of their objects is not reported",
+	}
+}
@@ -0,0 +1,56 @@
+package agent
+
+import (
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	workv1 "open-cluster-management.io/api/work/v1"
+
+	"github.com/kubestellar/ocm-status-addon/api/v1alpha1"
+	"github.com/kubestellar/ocm-status-addon/pkg/util"
+)
+
+var appliedManifestWorkGvkKey = util.KeyForGroupVersionKind(workv1.GroupVersion.Group, workv1.GroupVersion.Version,
+	util.AppliedManifestWorkKind)
+
+// queueClassOf returns the class of a key in the work queue: deletions first, then the AppliedManifestWorks,
+// which start the tracking of their objects, and the objects not reported yet, then the routine updates.
+func (a *Agent) queueClassOf(item any) int {
+	key, ok := item.(util.Key)
+	if !ok {
+		return queueClassUpdate
+	}
+	if key.DeletedObject != nil {
+		return queueClassDelete
+	}
+	if key.GvkKey == appliedManifestWorkGvkKey {
+		return queueClassCreate
+	}
+	if _, reported := a.reportedObjects.Get(objectKey(key)); !reported {
+		return queueClassCreate
+	}
+	return queueClassUpdate
+}
+
+// queueFlowOf returns the flow of a key in the work queue, which is the kind of the object
+func queueFlowOf(item any) string {
+	if key, ok := item.(util.Key); ok {
+		return key.GvkKey
+	}
+	return ""
+}
+
+// objectKey returns the key of an object in the maps of the agent indexed by object, which
+// ignores the deleted object of the key in the work queue
+func objectKey(key util.Key) string {
+	return key.GvkKey + "/" + key.NamespaceNameKey
+}
+
+// markReported records the object of a WorkStatus found on the hub as reported
+func (a *Agent) markReported(workStatus *v1alpha1.WorkStatus) {
+	ref := workStatus.Spec.SourceRef
+	if ref.Kind == "" || ref.Name == "" {
+		return
+	}
+	key := util.KeyForGroupVersionKindAndObjectRef(
+		schema.GroupVersionKind{Group: ref.Group, Version: ref.Version, Kind: ref.Kind}, ref.Namespace, ref.Name)
+	a.reportedObjects.Set(objectKey(key), true)
+}
@@ -2,32 +2,57 @@ package agent
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"reflect"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
-	"k8s.io/apimachinery/pkg/types"
+	workv1 "open-cluster-management.io/api/work/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
-	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 
 	"github.com/kubestellar/ocm-status-addon/api/v1alpha1"
+	"github.com/kubestellar/ocm-status-addon/pkg/health"
 	"github.com/kubestellar/ocm-status-addon/pkg/ocm"
 	"github.com/kubestellar/ocm-status-addon/pkg/util"
 )
 
 const (
+	// prefixes of the label keys of the ManifestWorks of KubeStellar, which are reported by default.
+	// The legacy ManagedByKSLabelKeyPrefix is not in use since KubeStellar v0.21.0. We keep it for backward compatibility.
 	ManagedByKSLabelKeyPrefix = "managed-by.kubestellar.io"
 	TransportLabelPrefix      = "transport.kubestellar.io"
 	SingletonstatusLabelKey   = "managed-by.kubestellar.io/singletonstatus"
+
+	// labels of a WorkStatus with the identity of its object. A label is not set when the value is
+	// empty or not a valid label value, e.g. for names longer than 63 characters.
+	SourceGroupLabelKey     = "status.kubestellar.io/source-group"
+	SourceVersionLabelKey   = "status.kubestellar.io/source-version"
+	SourceKindLabelKey      = "status.kubestellar.io/source-kind"
+	SourceNamespaceLabelKey = "status.kubestellar.io/source-namespace"
+	SourceNameLabelKey      = "status.kubestellar.io/source-name"
+
+	// field manager used by the agent for server-side apply of WorkStatus objects
+	WorkStatusFieldManager = "status-addon-agent"
 )
 
 // main reconciliation loop. The returned bool value allows to re-enque even if no errors
-func (a *Agent) reconcile(key util.Key) (bool, error) {
+func (a *Agent) reconcile(ctx context.Context, key util.Key, traceContext util.TraceContext) (requeue bool, err error) {
+	start := time.Now()
+	outcome := outcomeSkip
+	ctx, span := startReconcileSpan(ctx, key, traceContext)
+	defer func() {
+		observeReconcile(key.GvkKey, outcome, start, err)
+		span.SetAttributes(attribute.String("outcome", outcome))
+		endSpan(span, err)
+	}()
+
 	isBeingDeleted := false
 	obj, err := util.GetObjectFromKey(a.listers, key)
 	if err != nil {
@@ -63,12 +88,30 @@ func (a *Agent) reconcile(key util.Key) (bool, error) {
 		return false, nil
 	}
 
-	// handle work status
-	if err := a.handleWorkStatus(obj, isBeingDeleted); err != nil {
-		return false, err
+	// check if selected by the tracking rules, the workstatuses of objects no longer
+	// selected are deleted by the anti-entropy reconciler
+	if !a.trackingRules.Load().Tracks(obj.GetObjectKind().GroupVersionKind().GroupKind(), obj.(metav1.Object).GetNamespace()) {
+		return false, nil
 	}
 
-	return false, nil
+	// the status of the objects of metadata-only kinds is read on demand
+	if !isBeingDeleted && a.isMetadataOnly(obj.GetObjectKind().GroupVersionKind().GroupKind()) {
+		if obj, err = a.getFullObject(ctx, obj); err != nil || obj == nil {
+			return err != nil, err
+		}
+	}
+
+	// handle work status
+	outcome, err = a.handleWorkStatus(ctx, obj, isBeingDeleted)
+	if err == nil {
+		// the next events of a reported object are routine updates in the work queue
+		if isBeingDeleted {
+			a.reportedObjects.Delete(objectKey(key))
+		} else {
+			a.reportedObjects.Set(objectKey(key), true)
+		}
+	}
+	return false, err
 }
 
 // returned bool is used to requeue without throwing an error
@@ -81,6 +124,18 @@ func (a *Agent) handleAppliedManifestWork(obj runtime.Object, isBeingDeleted boo
 		return true, err
 	}
 
+	// the objects applied for the other hubs the cluster is registered with are not reported to this hub,
+	// a deleted appliedmanifestwork is only handled if tracked
+	if !isBeingDeleted && aWork.Spec.HubHash != a.hubHash {
+		// logged once per appliedmanifestwork, as a wrong hub hash silently stops all the reports
+		if _, logged := a.otherHubAppliedWorks.Get(mObj.GetName()); !logged {
+			a.logger.Info("Ignoring applied manifest work of another hub, set --hub-hash (--agent-hub-hash on the controller) if the work agent reaches this hub with a different URL",
+				"name", mObj.GetName(), "hubHash", aWork.Spec.HubHash, "expectedHubHash", a.hubHash)
+			a.otherHubAppliedWorks.Set(mObj.GetName(), true)
+		}
+		return false, nil
+	}
+
 	if !isBeingDeleted {
 		// list of GVR requiring to start informers for
 		gvrs := ocm.ListGVRs(aWork)
@@ -117,6 +172,7 @@ func (a *Agent) handleAppliedManifestWork(obj runtime.Object, isBeingDeleted boo
 		a.trackedAppliedManifests.Set(mObj.GetName(), info)
 		go a.startInformers(gvrs, uids)
 	} else {
+		a.otherHubAppliedWorks.Delete(mObj.GetName())
 		appliedManifestWorkInfoIntf, ok := a.trackedAppliedManifests.Get(mObj.GetName())
 		if !ok {
 			a.logger.Info("could not find appliedManifestWorkInfo", "key", mObj.GetName())
@@ -130,18 +186,27 @@ func (a *Agent) handleAppliedManifestWork(obj runtime.Object, isBeingDeleted boo
 	return false, nil
 }
 
-func (a *Agent) handleWorkStatus(obj runtime.Object, isBeingDeleted bool) error {
+// handleWorkStatus creates, updates or deletes the WorkStatus of an object, and returns which
+// of these was done or outcomeSkip if no write was needed.
+func (a *Agent) handleWorkStatus(ctx context.Context, obj runtime.Object, isBeingDeleted bool) (string, error) {
 	mObj := obj.(metav1.Object)
 	namespace := a.clusterName
 
 	a.logger.Info("handling workstatus for", "object", util.GenerateObjectInfoString(obj))
 
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Minute)
 	defer cancel()
 
+	_, lookupSpan := tracer.Start(ctx, "manifestwork.lookup")
 	aWork, err := ocm.GetAppliedManifestWork(obj, a.listers)
 	if err != nil || aWork == nil {
-		return fmt.Errorf("AppliedManifestWork not found for object with name=%s", mObj.GetName())
+		err = fmt.Errorf("AppliedManifestWork not found for object with name=%s", mObj.GetName())
+		endSpan(lookupSpan, err)
+		return "", err
+	}
+	if aWork.Spec.HubHash != a.hubHash {
+		lookupSpan.End()
+		return outcomeSkip, nil
 	}
 
 	// init workstatus object
@@ -151,109 +216,225 @@ func (a *Agent) handleWorkStatus(obj runtime.Object, isBeingDeleted bool) error
 			Name:      util.BuildWorkstatusName(*aWork, obj),
 		},
 	}
+	legacyName := util.BuildLegacyWorkstatusName(*aWork, obj)
 
 	// delete WorkStatus if exists, when the workload object is deleted
 	if isBeingDeleted {
-		err := a.hubClient.Get(ctx, client.ObjectKeyFromObject(workStatus), workStatus, &client.GetOptions{})
-		if err != nil && !apierrors.IsNotFound(err) {
-			return err
-		}
-		err = a.hubClient.Delete(ctx, workStatus, &client.DeleteOptions{})
+		lookupSpan.End()
+		a.writtenStatuses.Delete(workStatus.Name)
+		err := a.hubClient.Delete(ctx, workStatus, &client.DeleteOptions{})
 		if err != nil {
-			a.logger.Info("workStatus was previously deleted", "workStatus-name", workStatus.Name)
-			return nil
+			if apierrors.IsNotFound(err) {
+				a.logger.Info("workStatus was previously deleted", "workStatus-name", workStatus.Name)
+				// the workstatus may not have been migrated from its legacy name yet
+				if err := a.deleteLegacyWorkStatus(ctx, legacyName); err != nil {
+					return "", err
+				}
+				return outcomeSkip, nil
+			}
+			return "", err
 		}
 		a.logger.Info("workStatus deleted", "workStatus-name", workStatus.Name)
-		return nil
+		return outcomeDelete, nil
 	}
 
-	// check if WorkStatus exists and if not create it
-	err = a.hubClient.Get(ctx, client.ObjectKeyFromObject(workStatus), workStatus, &client.GetOptions{})
+	// get the manifest work for this workstatus, used for the owner ref, the labels and the status details
+	manifestWork, err := a.manifestWorkLister.ManifestWorks(namespace).Get(aWork.Spec.ManifestWorkName)
 	if err != nil {
-		if apierrors.IsNotFound(err) {
-			// get the manifest work for this workstatus, so that we can set a owner ref
-			manifestWork, err := ocm.GetManifestWork(a.hubClient, aWork.Spec.ManifestWorkName, namespace)
-			if err != nil {
-				return fmt.Errorf("failed to get manifestWork: %w", err)
-			}
+		err = fmt.Errorf("failed to get manifestWork: %w", err)
+		endSpan(lookupSpan, err)
+		return "", newReportingError(reasonManifestWorkNotFound, workStatus.Name, aWork.Spec.ManifestWorkName, err)
+	}
+	lookupSpan.SetAttributes(attribute.String("manifestwork", manifestWork.Name))
+	lookupSpan.End()
+	linkManifestWorkTrace(trace.SpanFromContext(ctx), manifestWork)
 
-			// only update status for KS-managed (by bindingpolicies here) objects
-			// The legacy ManagedByKSLabelKeyPrefix is not in use since KubeStellar v0.21.0. We keep it for backward compatibility.
-			if !(util.HasPrefixInMap(manifestWork.Labels, ManagedByKSLabelKeyPrefix) || util.HasPrefixInMap(manifestWork.Labels, TransportLabelPrefix)) {
-				a.logger.Info("object not managed by a KS bindingpolicy, nothing to do", "object", aWork.Spec.ManifestWorkName, "namespace", namespace)
-				return nil
-			}
+	if !a.isManifestWorkEligible(manifestWork) {
+		a.logger.Info("manifestwork not selected for reporting, nothing to do", "object", aWork.Spec.ManifestWorkName, "namespace", namespace)
+		return outcomeSkip, nil
+	}
 
-			// set the owner reference
-			if err := controllerutil.SetControllerReference(manifestWork, workStatus, a.hubClient.Scheme()); err != nil {
-				return fmt.Errorf("failed to set controller reference: %w", err)
-			}
+	// set the owner reference
+	workStatus.OwnerReferences = []metav1.OwnerReference{
+		*metav1.NewControllerRef(manifestWork, workv1.GroupVersion.WithKind("ManifestWork")),
+	}
 
-			// copy labels from manifest work to workstatus - this will be useful for tracking source bindingpolicy
-			// TODO - need to do this also when labels are updated on manifest work
-			// TODO - there are currently no labels on workstatus but should consider merging in case labels are set
-			workStatus.Labels = manifestWork.Labels
+	// copy labels from manifest work to workstatus - this will be useful for tracking source bindingpolicy.
+	// The labels are applied on every change of the manifest work labels. Labels set on the workstatus by
+	// other field managers are preserved by server-side apply, and labels removed from the manifest work
+	// are removed from the workstatus.
+	workStatus.Labels = map[string]string{}
+	for key, val := range manifestWork.Labels {
+		workStatus.Labels[key] = val
+	}
 
-			// copy singleton label from the object, if exist
-			objLabels := mObj.GetLabels()
-			if val, ok := objLabels[SingletonstatusLabelKey]; ok {
-				workStatus.Labels[SingletonstatusLabelKey] = val
-			}
+	// copy singleton label from the object, if exist
+	if val, ok := mObj.GetLabels()[SingletonstatusLabelKey]; ok {
+		workStatus.Labels[SingletonstatusLabelKey] = val
+	}
 
-			// set object ref
-			gvk := schema.GroupVersionKind{
-				Group:   obj.GetObjectKind().GroupVersionKind().Group,
-				Version: obj.GetObjectKind().GroupVersionKind().Version,
-				Kind:    obj.GetObjectKind().GroupVersionKind().Kind}
+	// set object ref
+	gvk := schema.GroupVersionKind{
+		Group:   obj.GetObjectKind().GroupVersionKind().Group,
+		Version: obj.GetObjectKind().GroupVersionKind().Version,
+		Kind:    obj.GetObjectKind().GroupVersionKind().Kind}
 
-			// TODO - restMapper may not be updated for new APIs - need to do that or use different approach
-			gvr, err := util.GetGVR(a.restMapper, gvk)
-			if err != nil {
-				return fmt.Errorf("could not get gvr from restmapper for object: %s", err)
-			}
-			workStatus.Spec.SourceRef = v1alpha1.SourceRef{
-				Group:     gvr.Group,
-				Version:   gvr.Version,
-				Resource:  gvr.Resource,
-				Kind:      gvk.Kind,
-				Name:      mObj.GetName(),
-				Namespace: mObj.GetNamespace(),
-			}
-			workStatus.StatusDetails = v1alpha1.StatusDetails{
-				LastCurrencyUpdateTime: metav1.NewTime(time.Unix(0, 0)),
-			}
+	// the name of the workstatus is not readable for long names, the identity of the object is in labels
+	setSourceIdentityLabels(workStatus.Labels, gvk, mObj.GetNamespace(), mObj.GetName())
 
-			if err = a.hubClient.Create(ctx, workStatus, &client.CreateOptions{}); err != nil {
-				return fmt.Errorf("failed to create workStatus: %w", err)
-			}
-		} else {
-			return err
+	// the restmapper refreshes the group of the kind if it is not found, e.g. for a new API
+	gvr, err := util.GetGVR(a.restMapper, gvk)
+	if err != nil {
+		return "", newReportingError(reasonKindNotMapped, workStatus.Name, manifestWork.Name,
+			fmt.Errorf("could not get gvr from restmapper for object: %s", err))
+	}
+	workStatus.Spec.SourceRef = v1alpha1.SourceRef{
+		Group:     gvr.Group,
+		Version:   gvr.Version,
+		Resource:  gvr.Resource,
+		Kind:      gvk.Kind,
+		Name:      mObj.GetName(),
+		Namespace: mObj.GetNamespace(),
+	}
+
+	// generate status. An error getting the status is returned after the workstatus is applied.
+	// Sensitive values are redacted before the status leaves the cluster, and a status that
+	// could not be redacted is not reported.
+	rawStatus, redacted, truncation, statusErr := a.getStatusToReport(obj, gvk.GroupKind())
+	workStatus.Status.Raw = rawStatus
+	workStatus.RedactedFields = int32(redacted)
+	workStatus.Truncation = truncation
+
+	lastGeneration, lastGenerationIsApplied := ocm.GetStatusDetails(manifestWork, obj)
+	workStatus.StatusDetails.LastGeneration = lastGeneration
+	workStatus.StatusDetails.LastGenerationIsApplied = lastGenerationIsApplied
+
+	if uObj, ok := obj.(*unstructured.Unstructured); ok {
+		workStatus.Health = health.Assess(uObj)
+	}
+
+	// skip the writes if the content is the same last written for this workstatus
+	hash, err := workStatusHash(workStatus)
+	if err != nil {
+		return "", err
+	}
+	written, ok := a.getWrittenStatus(workStatus.Name)
+	if statusErr == nil && ok && written.hash == hash {
+		a.logger.V(2).Info("workStatus is up to date, skipping write", "workStatus-name", workStatus.Name)
+		workStatusWritesSkipped.Inc()
+		return outcomeSkip, nil
+	}
+
+	// space the updates of the workstatus, unless a condition changed its status
+	conditions := conditionStates(workStatus)
+	if statusErr == nil && ok {
+		if delay := a.updateDelay(gvk.GroupKind(), written, conditions); delay > 0 {
+			a.logger.V(2).Info("deferring workStatus update", "workStatus-name", workStatus.Name, "delay", delay)
+			a.deferUpdate(obj, delay)
+			return outcomeDefer, nil
 		}
 	}
 
-	// patch the workStatus with singleton label if the object was labeled
-	objLabels := mObj.GetLabels()
-	if objVal, ok := objLabels[SingletonstatusLabelKey]; ok {
-		if wsVal, ok := workStatus.Labels[SingletonstatusLabelKey]; !ok || wsVal != objVal {
-			patchString := fmt.Sprintf(`{"metadata":{"labels":{"%s":"%s"}}}`, SingletonstatusLabelKey, objVal)
-			err = a.hubClient.Patch(ctx, workStatus, client.RawPatch(types.MergePatchType, []byte(patchString)))
-			if err != nil {
-				return err
+	// the currency update time only moves when the generation or its applied state changed,
+	// and the transition time of a health condition only when its status changed
+	previous := &written
+	if !ok {
+		if previous, err = a.getWrittenStatusFromHub(ctx, workStatus.Name); err != nil {
+			return "", err
+		}
+	}
+	created := previous == nil
+	if created {
+		// a workstatus migrated from its legacy name keeps its currency update and transition times
+		if previous, err = a.getWrittenStatusFromHub(ctx, legacyName); err != nil {
+			return "", err
+		}
+	}
+	var previousDetails *v1alpha1.StatusDetails
+	var previousHealth *v1alpha1.Health
+	if previous != nil {
+		previousDetails = &previous.statusDetails
+		previousHealth = previous.health
+	}
+	workStatus.StatusDetails = nextStatusDetails(previousDetails, lastGeneration, lastGenerationIsApplied)
+	workStatus.Health = health.Merge(previousHealth, workStatus.Health)
+
+	if err := a.applyWorkStatus(ctx, workStatus); err != nil {
+		return "", newReportingError(reasonWriteFailed, workStatus.Name, manifestWork.Name, fmt.Errorf("failed to apply workStatus: %w", err))
+	}
+
+	if statusErr != nil {
+		return "", newReportingError(reasonStatusUnavailable, workStatus.Name, manifestWork.Name, statusErr)
+	}
+
+	if err := a.applyWorkStatusStatus(ctx, workStatus); err != nil {
+		return "", newReportingError(reasonWriteFailed, workStatus.Name, manifestWork.Name, fmt.Errorf("failed to apply workStatus status: %w", err))
+	}
+	a.writtenStatuses.Set(workStatus.Name, writtenStatus{hash: hash, statusDetails: workStatus.StatusDetails, health: workStatus.Health,
+		writtenAt: time.Now(), conditions: conditions})
+
+	if created {
+		// the workstatus with the legacy name is only deleted once its replacement is complete,
+		// so that the status of the object is reported at all times
+		if previous != nil {
+			if err := a.deleteLegacyWorkStatus(ctx, legacyName); err != nil {
+				return "", err
 			}
 		}
+		return outcomeCreate, nil
 	}
+	return outcomeUpdate, nil
+}
 
-	// generate status & update
-	rawStatus, err := util.GetObjectStatusAsBytes(obj)
-	if err != nil {
-		return err
+// getReportedStatus returns the status reported for an object, which is the projected status
+// if there is a projection for the kind of the object, or the whole status otherwise.
+func (a *Agent) getReportedStatus(obj runtime.Object) ([]byte, error) {
+	if uObj, ok := obj.(*unstructured.Unstructured); ok {
+		projected, found, err := a.statusProjector.Load().Project(uObj)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			return json.Marshal(projected)
+		}
 	}
+	return util.GetObjectStatusAsBytes(obj)
+}
 
-	workStatus.Status.Raw = rawStatus
-	err = a.hubClient.Status().Update(ctx, workStatus, &client.SubResourceUpdateOptions{})
-	if err != nil {
-		return err
+// manifestWorkEligibility is the decision of the selector for a version of a ManifestWork
+type manifestWorkEligibility struct {
+	resourceVersion string
+	eligible        bool
+}
+
+// isManifestWorkEligible returns whether the objects of a ManifestWork are reported, as selected by the
+// ManifestWork selector. The decision is cached per ManifestWork until the ManifestWork changes.
+func (a *Agent) isManifestWorkEligible(manifestWork *workv1.ManifestWork) bool {
+	if cached, ok := a.manifestWorkEligibility.Get(manifestWork.Name); ok {
+		if eligibility := cached.(manifestWorkEligibility); eligibility.resourceVersion == manifestWork.ResourceVersion {
+			return eligibility.eligible
+		}
 	}
+	eligible := a.manifestWorkSelector.Matches(manifestWork)
+	a.manifestWorkEligibility.Set(manifestWork.Name, manifestWorkEligibility{resourceVersion: manifestWork.ResourceVersion, eligible: eligible})
+	return eligible
+}
 
-	return nil
+// nextStatusDetails returns the status details for the given generation and its applied state.
+// The currency update time is only moved when any of them changed, as it records when the
+// agent became informed of the update. Before the first update it holds time.Unix(0, 0).
+func nextStatusDetails(previous *v1alpha1.StatusDetails, lastGeneration int64, lastGenerationIsApplied bool) v1alpha1.StatusDetails {
+	if previous == nil {
+		previous = &v1alpha1.StatusDetails{
+			LastCurrencyUpdateTime: metav1.NewTime(time.Unix(0, 0)),
+		}
+	}
+	if previous.LastGeneration == lastGeneration && previous.LastGenerationIsApplied == lastGenerationIsApplied {
+		return *previous
+	}
+	return v1alpha1.StatusDetails{
+		LastGeneration:          lastGeneration,
+		LastGenerationIsApplied: lastGenerationIsApplied,
+		LastCurrencyUpdateTime:  metav1.Now(),
+	}
 }
@@ -0,0 +1,59 @@
+package agent
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr/funcr"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	workv1 "open-cluster-management.io/api/work/v1"
+
+	"github.com/kubestellar/ocm-status-addon/pkg/util"
+)
+
+func TestHandleAppliedManifestWorkOfAnotherHub(t *testing.T) {
+	logged := []string{}
+	a := &Agent{
+		logger: funcr.New(func(prefix, args string) {
+			if strings.Contains(args, "another hub") {
+				logged = append(logged, args)
+			}
+		}, funcr.Options{}),
+		hubHash:                 "thishub",
+		trackedAppliedManifests: *util.NewSafeMap(),
+		otherHubAppliedWorks:    *util.NewSafeMap(),
+	}
+	aWork := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": workv1.GroupVersion.String(),
+		"kind":       util.AppliedManifestWorkKind,
+		"metadata":   map[string]any{"name": "otherhub-work"},
+		"spec":       map[string]any{"hubHash": "otherhub", "manifestWorkName": "work"},
+	}}
+
+	for i := 0; i < 3; i++ {
+		if requeue, err := a.handleAppliedManifestWork(aWork, false); requeue || err != nil {
+			t.Fatalf("got requeue %t and error %v, expected the AppliedManifestWork to be ignored", requeue, err)
+		}
+	}
+	if len(logged) != 1 {
+		t.Fatalf("got %d logs of the AppliedManifestWork of another hub, expected 1: %v", len(logged), logged)
+	}
+	if !strings.Contains(logged[0], "--hub-hash") || !strings.Contains(logged[0], `"hubHash"="otherhub"`) ||
+		!strings.Contains(logged[0], `"expectedHubHash"="thishub"`) {
+		t.Errorf("got log %s, expected the hashes and the --hub-hash flag", logged[0])
+	}
+	if _, tracked := a.trackedAppliedManifests.Get("otherhub-work"); tracked {
+		t.Error("expected the AppliedManifestWork of another hub not to be tracked")
+	}
+
+	// a recreated appliedmanifestwork is logged again
+	if _, err := a.handleAppliedManifestWork(aWork, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.handleAppliedManifestWork(aWork, false); err != nil {
+		t.Fatal(err)
+	}
+	if len(logged) != 2 {
+		t.Errorf("got %d logs of the AppliedManifestWork of another hub, expected 2 after its deletion", len(logged))
+	}
+}
@@ -0,0 +1,194 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+	workv1 "open-cluster-management.io/api/work/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/kubestellar/ocm-status-addon/api/v1alpha1"
+	"github.com/kubestellar/ocm-status-addon/pkg/util"
+)
+
+// The failures to report the status of an object are surfaced on the hub, where the owners of the
+// workload have no access to the logs of the agent: as events on the WorkStatus of the object, or on
+// its ManifestWork when the WorkStatus does not exist, and as the ReportingFailed condition of the
+// WorkStatus when the failures persist.
+const (
+	// interval between the events of an object failing with the same error
+	reportingEventInterval = 10 * time.Minute
+	// duration of the failures of an object after which the ReportingFailed condition is set
+	reportingFailedAfter = time.Minute
+	// source component of the reporting events
+	reportingEventComponent = "status-addon-agent"
+)
+
+// reasons of the reporting events and conditions
+const (
+	reasonManifestWorkNotFound = "ManifestWorkNotFound"
+	reasonKindNotMapped        = "KindNotMapped"
+	reasonStatusUnavailable    = "StatusUnavailable"
+	reasonWriteFailed          = "WriteFailed"
+	reasonReported             = "Reported"
+)
+
+// reportingError is a failure to report the status of an object, with the objects on the hub it relates to
+type reportingError struct {
+	reason       string
+	workStatus   string
+	manifestWork string
+	err          error
+}
+
+func newReportingError(reason, workStatus, manifestWork string, err error) error {
+	return &reportingError{reason: reason, workStatus: workStatus, manifestWork: manifestWork, err: err}
+}
+
+func (e *reportingError) Error() string {
+	return e.err.Error()
+}
+
+func (e *reportingError) Unwrap() error {
+	return e.err
+}
+
+// reportingFailure is the state of the failures of an object, since its first failure
+type reportingFailure struct {
+	reason       string
+	message      string
+	since        time.Time
+	lastEvent    time.Time
+	workStatus   string
+	conditionSet bool
+}
+
+// newEventBroadcaster returns a broadcaster of the events in the cluster namespace on the hub. The events
+// with the same object, reason and message are aggregated, and the events of an object are rate limited.
+func newEventBroadcaster(hubKubernetesClient kubernetes.Interface, clusterName string) (record.EventBroadcaster, record.EventRecorder) {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: hubKubernetesClient.CoreV1().Events(clusterName)})
+	recorder := broadcaster.NewRecorder(clientgoscheme.Scheme, corev1.EventSource{Component: reportingEventComponent, Host: clusterName})
+	return broadcaster, recorder
+}
+
+// recordReportingFailure records an event for a failure to report the status of an object when the error
+// changed or after the event interval, and sets the ReportingFailed condition of its WorkStatus when the
+// failures persist.
+func (a *Agent) recordReportingFailure(ctx context.Context, key util.Key, err error) {
+	var reportingErr *reportingError
+	if !errors.As(err, &reportingErr) {
+		return
+	}
+	now := time.Now()
+	failure := reportingFailure{since: now}
+	if previous, ok := a.reportingFailures.Get(objectKey(key)); ok {
+		failure = previous.(reportingFailure)
+	}
+	changed := failure.reason != reportingErr.reason || failure.message != reportingErr.Error()
+	failure.reason, failure.message = reportingErr.reason, reportingErr.Error()
+	persistent := now.Sub(failure.since) >= reportingFailedAfter
+	if !changed && now.Sub(failure.lastEvent) < reportingEventInterval && (!persistent || failure.conditionSet) {
+		a.reportingFailures.Set(objectKey(key), failure)
+		return
+	}
+
+	workStatus, err := a.getWorkStatus(ctx, reportingErr.workStatus)
+	if err != nil {
+		a.logger.Error(err, "could not get workstatus to report failure", "workStatus-name", reportingErr.workStatus)
+		a.reportingFailures.Set(objectKey(key), failure)
+		return
+	}
+	if changed || now.Sub(failure.lastEvent) >= reportingEventInterval {
+		if target := a.reportingEventTarget(workStatus, reportingErr.manifestWork); target != nil {
+			a.eventRecorder.Event(target, corev1.EventTypeWarning, reportingErr.reason, reportingErr.Error())
+		}
+		failure.lastEvent = now
+	}
+	if persistent && (changed || !failure.conditionSet) && workStatus != nil {
+		if err := a.setReportingFailedCondition(ctx, workStatus, metav1.ConditionTrue, failure.reason, failure.message); err != nil {
+			a.logger.Error(err, "could not set reporting failed condition", "workStatus-name", workStatus.Name)
+		} else {
+			failure.workStatus = workStatus.Name
+			failure.conditionSet = true
+		}
+	}
+	a.reportingFailures.Set(objectKey(key), failure)
+}
+
+// clearReportingFailure forgets the failures of an object whose status is reported, and resets
+// the ReportingFailed condition of its WorkStatus if it was set.
+func (a *Agent) clearReportingFailure(ctx context.Context, key util.Key) {
+	previous, ok := a.reportingFailures.Get(objectKey(key))
+	if !ok {
+		return
+	}
+	a.reportingFailures.Delete(objectKey(key))
+	failure := previous.(reportingFailure)
+	if !failure.conditionSet {
+		return
+	}
+	workStatus, err := a.getWorkStatus(ctx, failure.workStatus)
+	if err == nil && workStatus != nil {
+		err = a.setReportingFailedCondition(ctx, workStatus, metav1.ConditionFalse, reasonReported, "The status of the object is reported")
+	}
+	if err != nil {
+		a.logger.Error(err, "could not reset reporting failed condition", "workStatus-name", failure.workStatus)
+	}
+}
+
+// getWorkStatus returns a WorkStatus in the cluster namespace, or nil if it does not exist
+func (a *Agent) getWorkStatus(ctx context.Context, name string) (*v1alpha1.WorkStatus, error) {
+	if name == "" {
+		return nil, nil
+	}
+	workStatus := &v1alpha1.WorkStatus{}
+	if err := a.hubClient.Get(ctx, client.ObjectKey{Namespace: a.clusterName, Name: name}, workStatus); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return workStatus, nil
+}
+
+// reportingEventTarget returns the reference of the WorkStatus if it exists, otherwise of the ManifestWork
+func (a *Agent) reportingEventTarget(workStatus *v1alpha1.WorkStatus, manifestWorkName string) *corev1.ObjectReference {
+	if workStatus != nil {
+		return &corev1.ObjectReference{APIVersion: v1alpha1.GroupVersion.String(), Kind: "WorkStatus",
+			Namespace: workStatus.Namespace, Name: workStatus.Name, UID: workStatus.UID}
+	}
+	if manifestWorkName == "" {
+		return nil
+	}
+	reference := &corev1.ObjectReference{APIVersion: workv1.GroupVersion.String(), Kind: "ManifestWork",
+		Namespace: a.clusterName, Name: manifestWorkName}
+	if manifestWork, err := a.manifestWorkLister.ManifestWorks(a.clusterName).Get(manifestWorkName); err == nil {
+		reference.UID = manifestWork.UID
+	}
+	return reference
+}
+
+// setReportingFailedCondition patches the ReportingFailed condition of a WorkStatus. A merge patch is
+// used, as the WorkStatus must not be created if it was deleted in the meantime.
+func (a *Agent) setReportingFailedCondition(ctx context.Context, workStatus *v1alpha1.WorkStatus, status metav1.ConditionStatus, reason, message string) error {
+	original := workStatus.DeepCopy()
+	if !meta.SetStatusCondition(&workStatus.Conditions, metav1.Condition{
+		Type:    v1alpha1.WorkStatusConditionReportingFailed,
+		Status:  status,
+		Reason:  reason,
+		Message: message,
+	}) {
+		return nil
+	}
+	return a.hubClient.Patch(ctx, workStatus, client.MergeFromWithOptions(original, client.MergeFromWithOptimisticLock{}))
+}
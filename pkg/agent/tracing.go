@@ -0,0 +1,105 @@
+package agent
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	workv1 "open-cluster-management.io/api/work/v1"
+
+	"github.com/kubestellar/ocm-status-addon/pkg/util"
+)
+
+// TraceParentAnnotationKey is the annotation of a ManifestWork holding the W3C traceparent of the
+// trace that produced it. The spans of the reconciliation of the objects of the ManifestWork are
+// linked to that trace.
+const TraceParentAnnotationKey = "kubestellar.io/traceparent"
+
+// The global tracer provider is a no-op unless tracing is enabled. The spans of the no-op
+// provider are not sampled, so that no trace context is then recorded.
+var tracer = otel.Tracer("github.com/kubestellar/ocm-status-addon/pkg/agent")
+
+// setTraceContext records the trace context of the latest traced event of an object, which is continued
+// by the next reconciliation of the object. The trace context is kept out of the work queue items,
+// so that the events of an object are merged into a single item whether they are traced or not.
+func (a *Agent) setTraceContext(key util.Key, traceContext util.TraceContext) {
+	if traceContext.IsValid() {
+		a.traceContexts.Set(objectKey(key), traceContext)
+	}
+}
+
+// takeTraceContext returns and forgets the trace context recorded for an object, or the zero value
+func (a *Agent) takeTraceContext(key util.Key) util.TraceContext {
+	traceContext, ok := a.traceContexts.Get(objectKey(key))
+	if !ok {
+		return util.TraceContext{}
+	}
+	a.traceContexts.Delete(objectKey(key))
+	return traceContext.(util.TraceContext)
+}
+
+// restoreTraceContext records again the trace context of a reconciliation that is retried,
+// unless a newer event of the object was traced in the meantime
+func (a *Agent) restoreTraceContext(key util.Key, traceContext util.TraceContext) {
+	if _, ok := a.traceContexts.Get(objectKey(key)); !ok {
+		a.setTraceContext(key, traceContext)
+	}
+}
+
+// startReconcileSpan starts the span of the reconciliation of a key. With a trace context, the span
+// continues the trace of the event that enqueued the key, and a span covering the wait in the
+// workqueue is recorded before it.
+func startReconcileSpan(ctx context.Context, key util.Key, traceContext util.TraceContext) (context.Context, trace.Span) {
+	if traceContext.IsValid() {
+		ctx = trace.ContextWithRemoteSpanContext(ctx, traceContext.SpanContext())
+		_, waitSpan := tracer.Start(ctx, "workqueue.wait", trace.WithTimestamp(time.Unix(0, traceContext.EnqueueTime)))
+		waitSpan.End()
+	}
+	return tracer.Start(ctx, "reconcile", trace.WithAttributes(
+		attribute.String("gvk", key.GvkKey),
+		attribute.String("object", key.NamespaceNameKey),
+		attribute.Bool("deleted", key.DeletedObject != nil),
+	))
+}
+
+// endSpan records the error, if any, and ends a span
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// linkManifestWorkTrace links a span to the trace that produced a ManifestWork, if the
+// ManifestWork carries its trace context
+func linkManifestWorkTrace(span trace.Span, manifestWork *workv1.ManifestWork) {
+	traceParent, ok := manifestWork.Annotations[TraceParentAnnotationKey]
+	if !ok {
+		return
+	}
+	carrier := propagation.MapCarrier{"traceparent": traceParent}
+	spanContext := trace.SpanContextFromContext(propagation.TraceContext{}.Extract(context.Background(), carrier))
+	if spanContext.IsValid() {
+		span.AddLink(trace.Link{SpanContext: spanContext})
+	}
+}
+
+// newHubTracingRoundTripper records a span for each request to the hub made in the
+// context of a span, leaving out the requests of the informers
+func newHubTracingRoundTripper(rt http.RoundTripper) http.RoundTripper {
+	return otelhttp.NewTransport(rt,
+		otelhttp.WithFilter(func(req *http.Request) bool {
+			return trace.SpanContextFromContext(req.Context()).IsValid()
+		}),
+		otelhttp.WithSpanNameFormatter(func(_ string, req *http.Request) string {
+			return "hub " + req.Method
+		}),
+	)
+}
@@ -0,0 +1,103 @@
+package agent
+
+import (
+	"context"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/kubestellar/ocm-status-addon/pkg/ocm"
+	"github.com/kubestellar/ocm-status-addon/pkg/tracking"
+)
+
+// The informers for the tracked kinds cache all the objects of their kind in the cluster, while
+// only the objects applied by AppliedManifestWorks are reported. The objects are transformed before
+// being cached to drop what the agent never reads: the managed fields and the last applied
+// configuration of all objects, and everything but the metadata of the objects not applied by an
+// AppliedManifestWork. An object applied later is cached in full with the update adding its owner.
+//
+// For the kinds selected by the metadata-only rules, the informers only list and watch the metadata
+// of the objects, and the objects reported are read from the cluster when reconciled.
+
+const lastAppliedConfigAnnotationKey = "kubectl.kubernetes.io/last-applied-configuration"
+
+// newObjectTransform returns the transform of the objects cached by an informer. The objects of
+// the tracked kinds not applied by an AppliedManifestWork are reduced to their metadata.
+func newObjectTransform(tracked bool) cache.TransformFunc {
+	return func(obj interface{}) (interface{}, error) {
+		u, ok := obj.(*unstructured.Unstructured)
+		if !ok {
+			return obj, nil
+		}
+		if tracked && !ocm.IsManagedByAppliedManifestWork(u) {
+			u = metadataOnly(u.GroupVersionKind(), u.Object["metadata"])
+		}
+		stripMetadata(u)
+		return u, nil
+	}
+}
+
+// newMetadataTransform returns the transform of the objects cached by a metadata-only informer,
+// which turns them into unstructured objects of their kind so that they are handled like the
+// objects of the other informers.
+func newMetadataTransform(gvk schema.GroupVersionKind) cache.TransformFunc {
+	return func(obj interface{}) (interface{}, error) {
+		partial, ok := obj.(*metav1.PartialObjectMetadata)
+		if !ok {
+			return obj, nil
+		}
+		metadata, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&partial.ObjectMeta)
+		if err != nil {
+			return nil, err
+		}
+		u := metadataOnly(gvk, metadata)
+		stripMetadata(u)
+		return u, nil
+	}
+}
+
+func metadataOnly(gvk schema.GroupVersionKind, metadata interface{}) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{Object: map[string]interface{}{"metadata": metadata}}
+	u.SetGroupVersionKind(gvk)
+	return u
+}
+
+func stripMetadata(u *unstructured.Unstructured) {
+	u.SetManagedFields(nil)
+	if annotations := u.GetAnnotations(); annotations != nil {
+		if _, ok := annotations[lastAppliedConfigAnnotationKey]; ok {
+			delete(annotations, lastAppliedConfigAnnotationKey)
+			u.SetAnnotations(annotations)
+		}
+	}
+}
+
+// isMetadataOnly returns true if the objects of a kind are watched with a metadata-only informer
+func (a *Agent) isMetadataOnly(gk schema.GroupKind) bool {
+	return tracking.MatchesGroupKind(a.metadataOnlyRules, gk)
+}
+
+// getFullObject reads from the cluster an object of a kind watched with a metadata-only informer.
+// It returns nil if the object no longer exists.
+func (a *Agent) getFullObject(ctx context.Context, obj runtime.Object) (runtime.Object, error) {
+	gvk := obj.GetObjectKind().GroupVersionKind()
+	mObj := obj.(metav1.Object)
+	mapping, err := a.restMapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return nil, err
+	}
+	full, err := a.managedDynamicClient.Resource(mapping.Resource).Namespace(mObj.GetNamespace()).
+		Get(ctx, mObj.GetName(), metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	stripMetadata(full)
+	return full, nil
+}
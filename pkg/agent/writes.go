@@ -0,0 +1,220 @@
+package agent
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	utiljson "k8s.io/apimachinery/pkg/util/json"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/kubestellar/ocm-status-addon/api/v1alpha1"
+)
+
+// The agent remembers a hash of the content it last wrote for each WorkStatus, so that
+// informer events that do not change the reported content (e.g. resync or changes in
+// the object spec or metadata) do not cause writes to the hub.
+type writtenStatus struct {
+	hash          string
+	statusDetails v1alpha1.StatusDetails
+	health        *v1alpha1.Health
+	// time of the last write by the agent, zero for a WorkStatus found on the hub
+	writtenAt  time.Time
+	conditions string
+}
+
+// seedWrittenStatuses initializes the hashes with the WorkStatuses found on the hub, so that
+// a restart of the agent does not rewrite all WorkStatuses in the cluster namespace.
+func (a *Agent) seedWrittenStatuses(ctx context.Context) error {
+	list := &v1alpha1.WorkStatusList{}
+	if err := a.hubClient.List(ctx, list, client.InNamespace(a.clusterName)); err != nil {
+		return err
+	}
+	for i := range list.Items {
+		hash, err := hubWorkStatusHash(&list.Items[i])
+		if err != nil {
+			a.logger.Error(err, "could not compute hash for workstatus", "workStatus-name", list.Items[i].Name)
+			continue
+		}
+		a.writtenStatuses.Set(list.Items[i].Name, writtenStatus{hash: hash, statusDetails: list.Items[i].StatusDetails, health: list.Items[i].Health,
+			conditions: conditionStates(&list.Items[i])})
+		a.markReported(&list.Items[i])
+	}
+	a.logger.Info("Seeded written workstatuses from hub", "count", len(list.Items))
+	return nil
+}
+
+func (a *Agent) getWrittenStatus(name string) (writtenStatus, bool) {
+	written, ok := a.writtenStatuses.Get(name)
+	if !ok {
+		return writtenStatus{}, false
+	}
+	return written.(writtenStatus), true
+}
+
+// getWrittenStatusFromHub returns the status details and health of a WorkStatus not written by
+// the agent yet, or nil if the WorkStatus does not exist. The returned hash is empty.
+func (a *Agent) getWrittenStatusFromHub(ctx context.Context, name string) (*writtenStatus, error) {
+	workStatus := &v1alpha1.WorkStatus{}
+	err := a.hubClient.Get(ctx, client.ObjectKey{Namespace: a.clusterName, Name: name}, workStatus, &client.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &writtenStatus{statusDetails: workStatus.StatusDetails, health: workStatus.Health}, nil
+}
+
+// applyWorkStatus uses server-side apply to create or update the metadata, spec and
+// status details of a WorkStatus. Only the labels and owner references set on the given
+// WorkStatus are owned by the agent, so that the ones set by others are preserved.
+func (a *Agent) applyWorkStatus(ctx context.Context, workStatus *v1alpha1.WorkStatus) error {
+	u := newWorkStatusApplyObject(workStatus)
+	u.SetLabels(workStatus.Labels)
+	u.SetOwnerReferences(workStatus.OwnerReferences)
+
+	sourceRef, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&workStatus.Spec.SourceRef)
+	if err != nil {
+		return err
+	}
+	u.Object["spec"] = map[string]interface{}{"sourceRef": sourceRef}
+
+	statusDetails, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&workStatus.StatusDetails)
+	if err != nil {
+		return err
+	}
+	u.Object["statusDetails"] = statusDetails
+
+	if workStatus.Health != nil {
+		health, err := runtime.DefaultUnstructuredConverter.ToUnstructured(workStatus.Health)
+		if err != nil {
+			return err
+		}
+		u.Object["health"] = health
+	}
+
+	if workStatus.RedactedFields > 0 {
+		u.Object["redactedFields"] = int64(workStatus.RedactedFields)
+	}
+
+	if workStatus.Truncation != nil {
+		truncation, err := runtime.DefaultUnstructuredConverter.ToUnstructured(workStatus.Truncation)
+		if err != nil {
+			return err
+		}
+		u.Object["truncation"] = truncation
+	}
+
+	return a.hubClient.Patch(ctx, u, client.Apply, client.FieldOwner(WorkStatusFieldManager), client.ForceOwnership)
+}
+
+// applyWorkStatusStatus uses server-side apply to update the status subresource of a WorkStatus.
+func (a *Agent) applyWorkStatusStatus(ctx context.Context, workStatus *v1alpha1.WorkStatus) error {
+	u := newWorkStatusApplyObject(workStatus)
+
+	var status interface{}
+	if err := utiljson.Unmarshal(workStatus.Status.Raw, &status); err != nil {
+		return err
+	}
+	u.Object["status"] = status
+
+	return a.hubClient.Status().Patch(ctx, u, client.Apply, client.FieldOwner(WorkStatusFieldManager), client.ForceOwnership)
+}
+
+func newWorkStatusApplyObject(workStatus *v1alpha1.WorkStatus) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{}
+	u.SetGroupVersionKind(v1alpha1.GroupVersion.WithKind("WorkStatus"))
+	u.SetNamespace(workStatus.Namespace)
+	u.SetName(workStatus.Name)
+	return u
+}
+
+// workStatusHash computes a hash of the content of a WorkStatus managed by the agent: the status,
+// the status details and health that are not timestamps, the redaction and truncation records and the labels.
+// The raw status is normalized, so that semantically equal statuses have the same hash
+// regardless of the encoding.
+func workStatusHash(workStatus *v1alpha1.WorkStatus) (string, error) {
+	var status any
+	if len(workStatus.Status.Raw) > 0 {
+		if err := json.Unmarshal(workStatus.Status.Raw, &status); err != nil {
+			return "", err
+		}
+	}
+	content := struct {
+		Status                  any                        `json:"status"`
+		LastGeneration          int64                      `json:"lastGeneration"`
+		LastGenerationIsApplied bool                       `json:"lastGenerationIsApplied"`
+		Labels                  map[string]string          `json:"labels,omitempty"`
+		Health                  any                        `json:"health,omitempty"`
+		RedactedFields          int32                      `json:"redactedFields,omitempty"`
+		Truncation              *v1alpha1.StatusTruncation `json:"truncation,omitempty"`
+	}{
+		Status:                  status,
+		LastGeneration:          workStatus.StatusDetails.LastGeneration,
+		LastGenerationIsApplied: workStatus.StatusDetails.LastGenerationIsApplied,
+		Labels:                  workStatus.Labels,
+		Health:                  healthWithoutTimes(workStatus.Health),
+		RedactedFields:          workStatus.RedactedFields,
+		Truncation:              workStatus.Truncation,
+	}
+	data, err := json.Marshal(content)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// hubWorkStatusHash computes the hash of a WorkStatus read from the hub, comparable with the hash of
+// the content written by the agent: the labels set by other field managers are left out.
+func hubWorkStatusHash(workStatus *v1alpha1.WorkStatus) (string, error) {
+	owned := *workStatus
+	owned.Labels = labelsOwnedBy(workStatus, WorkStatusFieldManager)
+	return workStatusHash(&owned)
+}
+
+// healthWithoutTimes returns a copy of a health without the transition times of the conditions.
+func healthWithoutTimes(health *v1alpha1.Health) *v1alpha1.Health {
+	if health == nil {
+		return nil
+	}
+	result := health.DeepCopy()
+	for i := range result.Conditions {
+		result.Conditions[i].LastTransitionTime = metav1.Time{}
+	}
+	return result
+}
+
+// labelsOwnedBy returns the labels of a WorkStatus that are owned by a field manager,
+// according to the managed fields of the WorkStatus.
+func labelsOwnedBy(workStatus *v1alpha1.WorkStatus, manager string) map[string]string {
+	owned := map[string]string{}
+	for _, entry := range workStatus.ManagedFields {
+		if entry.Manager != manager || entry.Subresource != "" || entry.FieldsV1 == nil {
+			continue
+		}
+		fields := struct {
+			Metadata struct {
+				Labels map[string]any `json:"f:labels"`
+			} `json:"f:metadata"`
+		}{}
+		if err := json.Unmarshal(entry.FieldsV1.Raw, &fields); err != nil {
+			continue
+		}
+		for field := range fields.Metadata.Labels {
+			key := strings.TrimPrefix(field, "f:")
+			if value, ok := workStatus.Labels[key]; ok {
+				owned[key] = value
+			}
+		}
+	}
+	return owned
+}
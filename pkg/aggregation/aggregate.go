@@ -0,0 +1,186 @@
+package aggregation
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	workv1 "open-cluster-management.io/api/work/v1"
+
+	"github.com/kubestellar/ocm-status-addon/api/v1alpha1"
+	"github.com/kubestellar/ocm-status-addon/pkg/tracking"
+	"github.com/kubestellar/ocm-status-addon/pkg/util"
+)
+
+// max length of the readable part of the name of an AggregatedWorkStatus
+const maxNamePrefixLength = 200
+
+// sourceKey identifies a source object across clusters. The version is not part of the key,
+// as the same object may be propagated and reported with different versions.
+type sourceKey struct {
+	Group     string
+	Kind      string
+	Namespace string
+	Name      string
+}
+
+func (k sourceKey) String() string {
+	return k.Group + "/" + k.Kind + "/" + k.Namespace + "/" + k.Name
+}
+
+func keyForSourceRef(ref v1alpha1.SourceRef) sourceKey {
+	return sourceKey{Group: ref.Group, Kind: ref.Kind, Namespace: ref.Namespace, Name: ref.Name}
+}
+
+// keysForManifestWork returns the keys of the objects included in a ManifestWork.
+// Manifests that cannot be decoded are ignored.
+func keysForManifestWork(mw *workv1.ManifestWork) []sourceKey {
+	keys := []sourceKey{}
+	for _, manifest := range mw.Spec.Workload.Manifests {
+		obj := metav1.PartialObjectMetadata{}
+		if err := json.Unmarshal(manifest.Raw, &obj); err != nil || obj.Kind == "" {
+			continue
+		}
+		gvk := schema.FromAPIVersionAndKind(obj.APIVersion, obj.Kind)
+		keys = append(keys, sourceKey{Group: gvk.Group, Kind: gvk.Kind, Namespace: obj.Namespace, Name: obj.Name})
+	}
+	return keys
+}
+
+func sourceKeyStrings(keys []sourceKey) []string {
+	result := make([]string, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, key.String())
+	}
+	return result
+}
+
+// aggregateName returns a readable and collision-free name for the AggregatedWorkStatus of
+// a source object, made of the kind, namespace and name followed by a hash of the key, with
+// the same rules as the names of the WorkStatuses.
+func aggregateName(key sourceKey) string {
+	parts := []string{key.Kind}
+	if key.Namespace != "" {
+		parts = append(parts, key.Namespace)
+	}
+	parts = append(parts, key.Name)
+	prefix := util.ToNameSegment(strings.Join(parts, "-"))
+	if len(prefix) > maxNamePrefixLength {
+		prefix = prefix[:maxNamePrefixLength]
+	}
+	prefix = strings.TrimRight(prefix, "-.")
+	sum := sha256.Sum256([]byte(key.String()))
+	return prefix + "-" + hex.EncodeToString(sum[:])[:16]
+}
+
+// expectedClusters returns the clusters expected to report a source object, that is the
+// namespaces of the ManifestWorks that include it and that are handled by the agents.
+func expectedClusters(manifestWorks []workv1.ManifestWork, selector tracking.ManifestWorkSelector) sets.Set[string] {
+	clusters := sets.New[string]()
+	for i := range manifestWorks {
+		mw := &manifestWorks[i]
+		if selector.Matches(mw) {
+			clusters.Insert(mw.Namespace)
+		}
+	}
+	return clusters
+}
+
+// sourceRefFor returns the source reference of the most recently created WorkStatus,
+// so that the version follows the one most recently propagated.
+func sourceRefFor(workStatuses []v1alpha1.WorkStatus) v1alpha1.SourceRef {
+	newest := workStatuses[0]
+	for _, ws := range workStatuses[1:] {
+		if newest.CreationTimestamp.Before(&ws.CreationTimestamp) {
+			newest = ws
+		}
+	}
+	return newest.Spec.SourceRef
+}
+
+// aggregateStatus summarizes the WorkStatuses reported for a source object.
+// A cluster is counted as ready when all its WorkStatuses for the source object are ready.
+func aggregateStatus(workStatuses []v1alpha1.WorkStatus, expected sets.Set[string]) v1alpha1.AggregatedWorkStatusStatus {
+	status := v1alpha1.AggregatedWorkStatusStatus{}
+	reported := sets.New[string]()
+	notReady := sets.New[string]()
+	for i := range workStatuses {
+		ws := &workStatuses[i]
+		entry := v1alpha1.ClusterWorkStatus{
+			Cluster:                 ws.Namespace,
+			WorkStatusName:          ws.Name,
+			Ready:                   isReady(ws),
+			LastGeneration:          ws.StatusDetails.LastGeneration,
+			LastGenerationIsApplied: ws.StatusDetails.LastGenerationIsApplied,
+			LastReportTime:          reportTime(ws),
+		}
+		status.Clusters = append(status.Clusters, entry)
+		reported.Insert(ws.Namespace)
+		if !entry.Ready {
+			notReady.Insert(ws.Namespace)
+		}
+		if status.OldestReportTime == nil || entry.LastReportTime.Before(status.OldestReportTime) {
+			status.OldestReportTime = entry.LastReportTime
+		}
+		if status.NewestReportTime == nil || status.NewestReportTime.Before(entry.LastReportTime) {
+			status.NewestReportTime = entry.LastReportTime
+		}
+	}
+	sort.Slice(status.Clusters, func(i, j int) bool {
+		if status.Clusters[i].Cluster != status.Clusters[j].Cluster {
+			return status.Clusters[i].Cluster < status.Clusters[j].Cluster
+		}
+		return status.Clusters[i].WorkStatusName < status.Clusters[j].WorkStatusName
+	})
+
+	status.ReportedClusters = int32(reported.Len())
+	status.ReadyClusters = int32(reported.Difference(notReady).Len())
+	status.ExpectedClusters = int32(expected.Union(reported).Len())
+	if missing := expected.Difference(reported); missing.Len() > 0 {
+		status.MissingClusters = sets.List(missing)
+	}
+	return status
+}
+
+// isReady returns whether a WorkStatus reports its object as ready. This is given by the health
+// assessed by the agent for the common kinds, otherwise by a Ready or Available condition in the
+// reported status when there is one, and otherwise by whether the last generation propagated to
+// the cluster is applied.
+func isReady(ws *v1alpha1.WorkStatus) bool {
+	if ws.Health != nil {
+		return ws.Health.Phase == v1alpha1.HealthPhaseHealthy
+	}
+	status := struct {
+		Conditions []struct {
+			Type   string `json:"type"`
+			Status string `json:"status"`
+		} `json:"conditions"`
+	}{}
+	if len(ws.Status.Raw) > 0 && json.Unmarshal(ws.Status.Raw, &status) == nil {
+		for _, conditionType := range []string{"Ready", "Available"} {
+			for _, condition := range status.Conditions {
+				if condition.Type == conditionType {
+					return condition.Status == string(metav1.ConditionTrue)
+				}
+			}
+		}
+	}
+	return ws.StatusDetails.LastGenerationIsApplied
+}
+
+// reportTime returns the time of the last write of the status subresource of a WorkStatus,
+// as recorded in the managed fields, or its creation time when there is none.
+func reportTime(ws *v1alpha1.WorkStatus) *metav1.Time {
+	result := ws.CreationTimestamp.DeepCopy()
+	for _, entry := range ws.ManagedFields {
+		if entry.Subresource == "status" && entry.Time != nil && result.Before(entry.Time) {
+			result = entry.Time.DeepCopy()
+		}
+	}
+	return result
+}
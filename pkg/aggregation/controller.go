@@ -0,0 +1,156 @@
+package aggregation
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	workv1 "open-cluster-management.io/api/work/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	"github.com/kubestellar/ocm-status-addon/api/v1alpha1"
+	"github.com/kubestellar/ocm-status-addon/pkg/tracking"
+)
+
+const (
+	ControllerName = "workstatus-aggregator"
+
+	// AggregatorFieldManager is the field manager used for the writes of AggregatedWorkStatuses
+	AggregatorFieldManager = "status-addon-aggregator"
+
+	// index of WorkStatuses and ManifestWorks by the key of their source objects
+	sourceKeyIndex = "sourceKey"
+)
+
+// Reconciler groups the WorkStatuses of all the clusters by their source object and
+// maintains an AggregatedWorkStatus for each source object.
+type Reconciler struct {
+	client client.Client
+	// selector of the ManifestWorks whose objects are reported by the agents
+	selector tracking.ManifestWorkSelector
+}
+
+func NewReconciler(c client.Client, selector tracking.ManifestWorkSelector) *Reconciler {
+	return &Reconciler{client: c, selector: selector}
+}
+
+// SetupWithManager sets up the indexes and the watches of the aggregation controller.
+func (r *Reconciler) SetupWithManager(mgr manager.Manager) error {
+	ctx := context.Background()
+	if err := mgr.GetFieldIndexer().IndexField(ctx, &v1alpha1.WorkStatus{}, sourceKeyIndex, func(obj client.Object) []string {
+		return []string{keyForSourceRef(obj.(*v1alpha1.WorkStatus).Spec.SourceRef).String()}
+	}); err != nil {
+		return err
+	}
+	if err := mgr.GetFieldIndexer().IndexField(ctx, &workv1.ManifestWork{}, sourceKeyIndex, func(obj client.Object) []string {
+		return sourceKeyStrings(keysForManifestWork(obj.(*workv1.ManifestWork)))
+	}); err != nil {
+		return err
+	}
+
+	return builder.TypedControllerManagedBy[sourceKey](mgr).
+		Named(ControllerName).
+		WatchesRawSource(source.TypedKind(mgr.GetCache(), &v1alpha1.WorkStatus{},
+			handler.TypedEnqueueRequestsFromMapFunc(func(_ context.Context, ws *v1alpha1.WorkStatus) []sourceKey {
+				return []sourceKey{keyForSourceRef(ws.Spec.SourceRef)}
+			}))).
+		WatchesRawSource(source.TypedKind(mgr.GetCache(), &workv1.ManifestWork{},
+			handler.TypedEnqueueRequestsFromMapFunc(func(_ context.Context, mw *workv1.ManifestWork) []sourceKey {
+				return keysForManifestWork(mw)
+			}))).
+		WatchesRawSource(source.TypedKind(mgr.GetCache(), &v1alpha1.AggregatedWorkStatus{},
+			handler.TypedEnqueueRequestsFromMapFunc(func(_ context.Context, agws *v1alpha1.AggregatedWorkStatus) []sourceKey {
+				return []sourceKey{keyForSourceRef(agws.Spec.SourceRef)}
+			}))).
+		Complete(r)
+}
+
+// Reconcile computes the AggregatedWorkStatus for a source object from the WorkStatuses
+// reporting it and the ManifestWorks including it. The AggregatedWorkStatus is deleted
+// when no WorkStatus reports the source object anymore.
+func (r *Reconciler) Reconcile(ctx context.Context, key sourceKey) (ctrl.Result, error) {
+	logger := log.FromContext(ctx).WithValues("source", key.String())
+	name := aggregateName(key)
+
+	workStatuses := &v1alpha1.WorkStatusList{}
+	if err := r.client.List(ctx, workStatuses, client.MatchingFields{sourceKeyIndex: key.String()}); err != nil {
+		return ctrl.Result{}, err
+	}
+	if len(workStatuses.Items) == 0 {
+		agws := &v1alpha1.AggregatedWorkStatus{}
+		agws.Name = name
+		if err := r.client.Delete(ctx, agws); err != nil {
+			if apierrors.IsNotFound(err) {
+				return ctrl.Result{}, nil
+			}
+			return ctrl.Result{}, err
+		}
+		logger.V(2).Info("Deleted aggregatedworkstatus", "name", name)
+		return ctrl.Result{}, nil
+	}
+
+	manifestWorks := &workv1.ManifestWorkList{}
+	if err := r.client.List(ctx, manifestWorks, client.MatchingFields{sourceKeyIndex: key.String()}); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	spec := v1alpha1.AggregatedWorkStatusSpec{SourceRef: sourceRefFor(workStatuses.Items)}
+	status := aggregateStatus(workStatuses.Items, expectedClusters(manifestWorks.Items, r.selector))
+
+	current := &v1alpha1.AggregatedWorkStatus{}
+	err := r.client.Get(ctx, client.ObjectKey{Name: name}, current)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return ctrl.Result{}, err
+	}
+	exists := err == nil
+	if !exists || !equality.Semantic.DeepEqual(current.Spec, spec) {
+		if err := r.applySpec(ctx, name, spec); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	if !exists || !equality.Semantic.DeepEqual(current.Status, status) {
+		if err := r.applyStatus(ctx, name, status); err != nil {
+			return ctrl.Result{}, err
+		}
+		logger.V(2).Info("Applied aggregatedworkstatus", "name", name,
+			"reported", status.ReportedClusters, "ready", status.ReadyClusters, "expected", status.ExpectedClusters)
+	}
+	return ctrl.Result{}, nil
+}
+
+// applySpec uses server-side apply to create or update the spec of an AggregatedWorkStatus.
+func (r *Reconciler) applySpec(ctx context.Context, name string, spec v1alpha1.AggregatedWorkStatusSpec) error {
+	u := newAggregateApplyObject(name)
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&spec)
+	if err != nil {
+		return err
+	}
+	u.Object["spec"] = content
+	return r.client.Patch(ctx, u, client.Apply, client.FieldOwner(AggregatorFieldManager), client.ForceOwnership)
+}
+
+// applyStatus uses server-side apply to update the status subresource of an AggregatedWorkStatus.
+func (r *Reconciler) applyStatus(ctx context.Context, name string, status v1alpha1.AggregatedWorkStatusStatus) error {
+	u := newAggregateApplyObject(name)
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&status)
+	if err != nil {
+		return err
+	}
+	u.Object["status"] = content
+	return r.client.Status().Patch(ctx, u, client.Apply, client.FieldOwner(AggregatorFieldManager), client.ForceOwnership)
+}
+
+func newAggregateApplyObject(name string) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{}
+	u.SetGroupVersionKind(v1alpha1.GroupVersion.WithKind("AggregatedWorkStatus"))
+	u.SetName(name)
+	return u
+}
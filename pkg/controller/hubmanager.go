@@ -0,0 +1,79 @@
+package controller
+
+import (
+	"encoding/json"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+	workapiv1 "open-cluster-management.io/api/work/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	crmetrics "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+
+	"github.com/kubestellar/ocm-status-addon/api/v1alpha1"
+)
+
+var hubScheme = runtime.NewScheme()
+
+func init() {
+	utilruntime.Must(clientgoscheme.AddToScheme(hubScheme))
+	utilruntime.Must(v1alpha1.AddToScheme(hubScheme))
+	utilruntime.Must(workapiv1.Install(hubScheme))
+	utilruntime.Must(addonapiv1alpha1.Install(hubScheme))
+}
+
+// NewHubManager returns a manager for the controller-runtime controllers running on the hub
+// next to the addon manager. The manager does not serve metrics nor probes and does not run
+// leader election, as it is started by the addon controller once it is the leader.
+//
+// The ManifestWorks of all cluster namespaces are cached with only the identity of their manifests,
+// which is all the controllers read, so that the cache does not hold a copy of every workload. The
+// manifests of a ManifestWork must be read with the API reader of the manager.
+func NewHubManager(kubeConfig *rest.Config) (manager.Manager, error) {
+	return ctrl.NewManager(kubeConfig, ctrl.Options{
+		Scheme:                 hubScheme,
+		Metrics:                crmetrics.Options{BindAddress: "0"},
+		HealthProbeBindAddress: "0",
+		Cache: cache.Options{
+			ByObject: map[client.Object]cache.ByObject{
+				&workapiv1.ManifestWork{}: {Transform: stripManifestWork},
+			},
+		},
+	})
+}
+
+// stripManifestWork reduces the manifests of a ManifestWork to their API version, kind, namespace and
+// name, and drops its managed fields. The manifests that cannot be decoded are emptied.
+func stripManifestWork(obj any) (any, error) {
+	mw, ok := obj.(*workapiv1.ManifestWork)
+	if !ok {
+		return obj, nil
+	}
+	mw.ManagedFields = nil
+	for i := range mw.Spec.Workload.Manifests {
+		manifest := &mw.Spec.Workload.Manifests[i]
+		partial := metav1.PartialObjectMetadata{}
+		if err := json.Unmarshal(manifest.Raw, &partial); err != nil {
+			manifest.Raw = nil
+			manifest.Object = nil
+			continue
+		}
+		identity := metav1.PartialObjectMetadata{
+			TypeMeta:   partial.TypeMeta,
+			ObjectMeta: metav1.ObjectMeta{Namespace: partial.Namespace, Name: partial.Name},
+		}
+		raw, err := json.Marshal(&identity)
+		if err != nil {
+			return nil, err
+		}
+		manifest.Raw = raw
+		manifest.Object = nil
+	}
+	return mw, nil
+}
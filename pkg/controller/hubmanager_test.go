@@ -0,0 +1,47 @@
+package controller
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	workapiv1 "open-cluster-management.io/api/work/v1"
+)
+
+func TestStripManifestWork(t *testing.T) {
+	mw := &workapiv1.ManifestWork{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:          "work",
+			Namespace:     "cluster1",
+			Labels:        map[string]string{"transport.kubestellar.io": "true"},
+			ManagedFields: []metav1.ManagedFieldsEntry{{Manager: "test"}},
+		},
+		Spec: workapiv1.ManifestWorkSpec{Workload: workapiv1.ManifestsTemplate{Manifests: []workapiv1.Manifest{
+			{RawExtension: runtime.RawExtension{Raw: []byte(`{"apiVersion":"apps/v1","kind":"Deployment",` +
+				`"metadata":{"name":"nginx","namespace":"default","labels":{"app":"nginx"}},"spec":{"replicas":3}}`)}},
+			{RawExtension: runtime.RawExtension{Raw: []byte(`{"apiVersion":"v1","kind":"Namespace","metadata":{"name":"team-a"}}`)}},
+			{RawExtension: runtime.RawExtension{Raw: []byte(`not json`)}},
+		}}},
+	}
+	result, err := stripManifestWork(mw)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	stripped := result.(*workapiv1.ManifestWork)
+	expected := []string{
+		`{"kind":"Deployment","apiVersion":"apps/v1","metadata":{"name":"nginx","namespace":"default"}}`,
+		`{"kind":"Namespace","apiVersion":"v1","metadata":{"name":"team-a"}}`,
+		``,
+	}
+	for i, manifest := range stripped.Spec.Workload.Manifests {
+		if string(manifest.Raw) != expected[i] {
+			t.Errorf("got manifest %d %s, expected %s", i, manifest.Raw, expected[i])
+		}
+	}
+	if stripped.ManagedFields != nil {
+		t.Errorf("got managed fields %v, expected none", stripped.ManagedFields)
+	}
+	if stripped.Labels["transport.kubestellar.io"] != "true" {
+		t.Errorf("got labels %v, expected the labels to be kept", stripped.Labels)
+	}
+}
@@ -51,10 +51,12 @@ func GetDefaultValues(cluster *clusterv1.ManagedCluster,
 		KubeConfigSecret      string
 		ClusterName           string
 		AddonInstallNamespace string
+		AddonName             string
 		Image                 string
 	}{
 		KubeConfigSecret:      fmt.Sprintf("%s-hub-kubeconfig", addon.Name),
 		AddonInstallNamespace: installNamespace,
+		AddonName:             addon.Name,
 		ClusterName:           cluster.Name,
 		Image:                 image,
 	}
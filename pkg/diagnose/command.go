@@ -0,0 +1,199 @@
+package diagnose
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/spf13/cobra"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	workv1 "open-cluster-management.io/api/work/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/kubestellar/ocm-status-addon/api/v1alpha1"
+	"github.com/kubestellar/ocm-status-addon/pkg/agent"
+	"github.com/kubestellar/ocm-status-addon/pkg/ocm"
+	"github.com/kubestellar/ocm-status-addon/pkg/tracking"
+)
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+)
+
+type Options struct {
+	HubKubeconfig   string
+	WECKubeconfig   string
+	ClusterName     string
+	HubHash         string
+	Output          string
+	TrackingInclude string
+	TrackingExclude string
+	// selection of the reported ManifestWorks, as configured on the agent
+	ManifestWorkLabelPrefixes      string
+	ManifestWorkLabelSelector      string
+	ManifestWorkAnnotationSelector string
+}
+
+// NewCommand returns the command that reports the gaps between the objects applied to a cluster
+// by the ManifestWorks and the WorkStatuses on the hub
+func NewCommand() *cobra.Command {
+	o := &Options{
+		Output:                    outputTable,
+		TrackingExclude:           tracking.DefaultExclude,
+		ManifestWorkLabelPrefixes: agent.ManagedByKSLabelKeyPrefix + "," + agent.TransportLabelPrefix,
+	}
+	cmd := &cobra.Command{
+		Use:   "diagnose",
+		Short: "Report missing, stale, orphaned and misnamed WorkStatuses of a cluster",
+		Long: "Cross-reference the ManifestWorks and WorkStatuses of a cluster on the hub and, when the kubeconfig of the " +
+			"cluster is given, its AppliedManifestWorks and the objects they applied, and report the WorkStatuses that are " +
+			"missing, stale, orphaned or misnamed. The misnamed WorkStatuses and the statuses that differ from the objects " +
+			"are only found when the cluster is inspected.",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return o.Run(cmd.Context(), cmd.OutOrStdout())
+		},
+	}
+	flags := cmd.Flags()
+	flags.StringVar(&o.HubKubeconfig, "hub-kubeconfig", o.HubKubeconfig,
+		"Kubeconfig of the hub, the default kubeconfig if empty")
+	flags.StringVar(&o.WECKubeconfig, "wec-kubeconfig", o.WECKubeconfig,
+		"Optional kubeconfig of the managed cluster, to inspect its AppliedManifestWorks and the objects they applied")
+	flags.StringVar(&o.ClusterName, "cluster-name", o.ClusterName, "Name of the managed cluster on the hub")
+	flags.StringVar(&o.HubHash, "hub-hash", o.HubHash,
+		"Hash of the hub in the AppliedManifestWorks, as set with the --hub-hash flag of the agent; computed from the server of the hub kubeconfig if empty")
+	flags.StringVarP(&o.Output, "output", "o", o.Output, "Output format, table or json")
+	flags.StringVar(&o.TrackingInclude, "tracking-include", o.TrackingInclude,
+		"Tracking include rules of the agent, as set with its --tracking-include flag")
+	flags.StringVar(&o.TrackingExclude, "tracking-exclude", o.TrackingExclude,
+		"Tracking exclude rules of the agent, as set with its --tracking-exclude flag")
+	flags.StringVar(&o.ManifestWorkLabelPrefixes, "manifestwork-label-prefixes", o.ManifestWorkLabelPrefixes,
+		"Label key prefixes of the reported ManifestWorks, as set with the --manifestwork-label-prefixes flag of the agent")
+	flags.StringVar(&o.ManifestWorkLabelSelector, "manifestwork-label-selector", o.ManifestWorkLabelSelector,
+		"Label selector of the reported ManifestWorks, as set with the --manifestwork-label-selector flag of the agent")
+	flags.StringVar(&o.ManifestWorkAnnotationSelector, "manifestwork-annotation-selector", o.ManifestWorkAnnotationSelector,
+		"Annotation selector of the reported ManifestWorks, as set with the --manifestwork-annotation-selector flag of the agent")
+	_ = cmd.MarkFlagRequired("cluster-name")
+	return cmd
+}
+
+// Run collects the state of the cluster, and writes the report
+func (o *Options) Run(ctx context.Context, out io.Writer) error {
+	if o.Output != outputTable && o.Output != outputJSON {
+		return fmt.Errorf("unsupported output %q, expected %s or %s", o.Output, outputTable, outputJSON)
+	}
+	include, err := tracking.ParseRules(o.TrackingInclude)
+	if err != nil {
+		return err
+	}
+	exclude, err := tracking.ParseRules(o.TrackingExclude)
+	if err != nil {
+		return err
+	}
+
+	selector, err := tracking.ParseManifestWorkSelector(o.ManifestWorkLabelPrefixes, o.ManifestWorkLabelSelector, o.ManifestWorkAnnotationSelector)
+	if err != nil {
+		return err
+	}
+
+	state, err := o.collect(ctx)
+	if err != nil {
+		return err
+	}
+	report := diagnose(o.ClusterName, state, tracking.Rules{Include: include, Exclude: exclude}, selector)
+	if o.Output == outputJSON {
+		return report.writeJSON(out)
+	}
+	return report.writeTable(out)
+}
+
+func (o *Options) collect(ctx context.Context) (*clusterState, error) {
+	hubConfig, err := loadConfig(o.HubKubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("could not load hub kubeconfig: %w", err)
+	}
+	hubClientPtr, err := ocm.NewClient(hubConfig)
+	if err != nil {
+		return nil, err
+	}
+	hubClient := *hubClientPtr
+
+	state := &clusterState{}
+	manifestWorks := &workv1.ManifestWorkList{}
+	if err := hubClient.List(ctx, manifestWorks, client.InNamespace(o.ClusterName)); err != nil {
+		return nil, fmt.Errorf("could not list manifestworks on hub: %w", err)
+	}
+	state.manifestWorks = manifestWorks.Items
+	workStatuses := &v1alpha1.WorkStatusList{}
+	if err := hubClient.List(ctx, workStatuses, client.InNamespace(o.ClusterName)); err != nil {
+		return nil, fmt.Errorf("could not list workstatuses on hub: %w", err)
+	}
+	state.workStatuses = workStatuses.Items
+
+	if o.WECKubeconfig == "" {
+		return state, nil
+	}
+	wecConfig, err := loadConfig(o.WECKubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("could not load wec kubeconfig: %w", err)
+	}
+	hubHash := o.HubHash
+	if hubHash == "" {
+		hubHash = ocm.HubHash(hubConfig.Host)
+	}
+	if state.applied, err = collectAppliedObjects(ctx, wecConfig, hubHash); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// collectAppliedObjects returns the objects applied by the AppliedManifestWorks of a cluster for the hub
+// with the given hash
+func collectAppliedObjects(ctx context.Context, config *rest.Config, hubHash string) ([]appliedObject, error) {
+	wecClientPtr, err := ocm.NewClient(config)
+	if err != nil {
+		return nil, err
+	}
+	wecClient := *wecClientPtr
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	aWorks := &workv1.AppliedManifestWorkList{}
+	if err := wecClient.List(ctx, aWorks); err != nil {
+		return nil, fmt.Errorf("could not list appliedmanifestworks: %w", err)
+	}
+	applied := []appliedObject{}
+	for i := range aWorks.Items {
+		aWork := &aWorks.Items[i]
+		if aWork.Spec.HubHash != hubHash {
+			continue
+		}
+		for _, resource := range aWork.Status.AppliedResources {
+			gvr := schema.GroupVersionResource{Group: resource.Group, Version: resource.Version, Resource: resource.Resource}
+			obj, err := dynamicClient.Resource(gvr).Namespace(resource.Namespace).Get(ctx, resource.Name, metav1.GetOptions{})
+			if err != nil && !apierrors.IsNotFound(err) {
+				return nil, fmt.Errorf("could not get %s %s/%s: %w", gvr.String(), resource.Namespace, resource.Name, err)
+			}
+			if err != nil {
+				obj = nil
+			}
+			applied = append(applied, appliedObject{appliedManifestWork: aWork, resource: resource, object: obj})
+		}
+	}
+	return applied, nil
+}
+
+// loadConfig loads a kubeconfig, or the default kubeconfig if the path is empty
+func loadConfig(path string) (*rest.Config, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = path
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{}).ClientConfig()
+}
@@ -0,0 +1,326 @@
+package diagnose
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	workv1 "open-cluster-management.io/api/work/v1"
+
+	"github.com/kubestellar/ocm-status-addon/api/v1alpha1"
+	"github.com/kubestellar/ocm-status-addon/pkg/ocm"
+	"github.com/kubestellar/ocm-status-addon/pkg/redaction"
+	"github.com/kubestellar/ocm-status-addon/pkg/tracking"
+	"github.com/kubestellar/ocm-status-addon/pkg/util"
+)
+
+// types of the issues found
+const (
+	// the object has no WorkStatus
+	IssueMissing = "missing"
+	// the WorkStatus does not report the generation of the ManifestWork applied to the cluster or the status of the object
+	IssueStale = "stale"
+	// the WorkStatus has no tracked object
+	IssueOrphaned = "orphaned"
+	// the WorkStatus of an object does not have the expected name, e.g. a legacy name or a duplicate
+	IssueMisnamed = "misnamed"
+)
+
+// Report lists the issues found with the WorkStatuses of a cluster
+type Report struct {
+	Cluster string `json:"cluster"`
+	// whether the AppliedManifestWorks and the objects of the cluster were inspected
+	InspectedWEC  bool    `json:"inspectedWEC"`
+	ManifestWorks int     `json:"manifestWorks"`
+	WorkStatuses  int     `json:"workStatuses"`
+	Issues        []Issue `json:"issues"`
+}
+
+type Issue struct {
+	Type         string `json:"type"`
+	WorkStatus   string `json:"workStatus,omitempty"`
+	ManifestWork string `json:"manifestWork,omitempty"`
+	Object       string `json:"object,omitempty"`
+	Detail       string `json:"detail"`
+}
+
+// clusterState holds what is collected from the hub and, optionally, from the cluster
+type clusterState struct {
+	manifestWorks []workv1.ManifestWork
+	workStatuses  []v1alpha1.WorkStatus
+	// nil when the cluster is not inspected
+	applied []appliedObject
+}
+
+// appliedObject is a resource applied by an AppliedManifestWork, with the object if it exists
+type appliedObject struct {
+	appliedManifestWork *workv1.AppliedManifestWork
+	resource            workv1.AppliedManifestResourceMeta
+	object              *unstructured.Unstructured
+}
+
+type objectIdentity struct {
+	Group, Version, Kind, Namespace, Name string
+}
+
+func (id objectIdentity) String() string {
+	namespaceName := id.Name
+	if id.Namespace != "" {
+		namespaceName = id.Namespace + "/" + id.Name
+	}
+	return util.KeyForGroupVersionKind(id.Group, id.Version, id.Kind) + "/" + namespaceName
+}
+
+// object returns an object with the identity, to look up its conditions in the status of a ManifestWork
+func (id objectIdentity) object() *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(schema.GroupVersionKind{Group: id.Group, Version: id.Version, Kind: id.Kind})
+	obj.SetNamespace(id.Namespace)
+	obj.SetName(id.Name)
+	return obj
+}
+
+// expectedStatus is an object that should have a WorkStatus
+type expectedStatus struct {
+	manifestWork *workv1.ManifestWork
+	// set when the cluster is inspected
+	name   string
+	object *unstructured.Unstructured
+}
+
+// diagnose cross-references the state of a cluster. Without the AppliedManifestWorks, the objects
+// that should have a WorkStatus are the ones in the resource status of the ManifestWorks.
+func diagnose(cluster string, state *clusterState, rules tracking.Rules, selector tracking.ManifestWorkSelector) Report {
+	report := Report{
+		Cluster:       cluster,
+		InspectedWEC:  state.applied != nil,
+		ManifestWorks: len(state.manifestWorks),
+		WorkStatuses:  len(state.workStatuses),
+		Issues:        []Issue{},
+	}
+
+	manifestWorks := map[string]*workv1.ManifestWork{}
+	for i := range state.manifestWorks {
+		manifestWorks[state.manifestWorks[i].Name] = &state.manifestWorks[i]
+	}
+
+	expected := map[objectIdentity]*expectedStatus{}
+	if state.applied == nil {
+		for _, manifestWork := range manifestWorks {
+			if !selector.Matches(manifestWork) {
+				continue
+			}
+			for _, manifest := range manifestWork.Status.ResourceStatus.Manifests {
+				meta := manifest.ResourceMeta
+				id := objectIdentity{Group: meta.Group, Version: meta.Version, Kind: meta.Kind, Namespace: meta.Namespace, Name: meta.Name}
+				if meta.Kind == "" || !rules.Tracks(schema.GroupKind{Group: meta.Group, Kind: meta.Kind}, meta.Namespace) {
+					continue
+				}
+				expected[id] = &expectedStatus{manifestWork: manifestWork}
+			}
+		}
+	} else {
+		for _, applied := range state.applied {
+			manifestWork, ok := manifestWorks[applied.appliedManifestWork.Spec.ManifestWorkName]
+			if !ok || !selector.Matches(manifestWork) || applied.object == nil {
+				continue
+			}
+			gvk := applied.object.GroupVersionKind()
+			if !rules.Tracks(gvk.GroupKind(), applied.object.GetNamespace()) || !ocm.IsManagedByAppliedManifestWork(applied.object) {
+				continue
+			}
+			id := objectIdentity{Group: gvk.Group, Version: gvk.Version, Kind: gvk.Kind,
+				Namespace: applied.object.GetNamespace(), Name: applied.object.GetName()}
+			expected[id] = &expectedStatus{
+				manifestWork: manifestWork,
+				name:         util.BuildWorkstatusName(*applied.appliedManifestWork, applied.object),
+				object:       applied.object,
+			}
+		}
+	}
+
+	byIdentity := map[objectIdentity][]*v1alpha1.WorkStatus{}
+	for i := range state.workStatuses {
+		ref := state.workStatuses[i].Spec.SourceRef
+		id := objectIdentity{Group: ref.Group, Version: ref.Version, Kind: ref.Kind, Namespace: ref.Namespace, Name: ref.Name}
+		byIdentity[id] = append(byIdentity[id], &state.workStatuses[i])
+	}
+
+	matched := map[string]bool{}
+	for id, exp := range expected {
+		workStatuses := byIdentity[id]
+		if len(workStatuses) == 0 {
+			report.add(IssueMissing, "", exp.manifestWork.Name, id, "the object has no WorkStatus")
+			continue
+		}
+		var current *v1alpha1.WorkStatus
+		for _, workStatus := range workStatuses {
+			matched[workStatus.Name] = true
+			if current == nil && (exp.name == "" || workStatus.Name == exp.name) {
+				current = workStatus
+				continue
+			}
+			detail := "the object has several WorkStatuses"
+			if exp.name != "" {
+				detail = fmt.Sprintf("the WorkStatus of the object is expected to be named %s", exp.name)
+			}
+			report.add(IssueMisnamed, workStatus.Name, exp.manifestWork.Name, id, detail)
+		}
+		if current == nil {
+			continue
+		}
+		// the WorkStatus reports the generation that reached the cluster, which is behind the generation
+		// of the ManifestWork while it is rolled out
+		appliedGeneration, _ := ocm.GetStatusDetails(exp.manifestWork, id.object())
+		if current.StatusDetails.LastGeneration < appliedGeneration {
+			report.add(IssueStale, current.Name, exp.manifestWork.Name, id, fmt.Sprintf(
+				"the WorkStatus reports generation %d of the ManifestWork, which is applied at generation %d",
+				current.StatusDetails.LastGeneration, appliedGeneration))
+		} else if exp.object != nil && !isStatusReported(current, exp.object) {
+			report.add(IssueStale, current.Name, exp.manifestWork.Name, id,
+				"the status in the WorkStatus differs from the status of the object")
+		}
+	}
+
+	for i := range state.workStatuses {
+		workStatus := &state.workStatuses[i]
+		owner := metav1.GetControllerOf(workStatus)
+		// only the workstatuses written by the agent are owned by a manifestwork
+		if matched[workStatus.Name] || owner == nil || owner.Kind != "ManifestWork" {
+			continue
+		}
+		ref := workStatus.Spec.SourceRef
+		id := objectIdentity{Group: ref.Group, Version: ref.Version, Kind: ref.Kind, Namespace: ref.Namespace, Name: ref.Name}
+		detail := "the object is not a tracked object of the ManifestWork"
+		if manifestWork, ok := manifestWorks[owner.Name]; !ok {
+			detail = "the ManifestWork of the WorkStatus does not exist"
+		} else if !selector.Matches(manifestWork) {
+			detail = "the ManifestWork of the WorkStatus is not reported by the agent"
+		} else if report.InspectedWEC {
+			detail = "the object is not applied to the cluster by the ManifestWork"
+		}
+		report.add(IssueOrphaned, workStatus.Name, owner.Name, id, detail)
+	}
+
+	sort.Slice(report.Issues, func(i, j int) bool {
+		a, b := report.Issues[i], report.Issues[j]
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		if a.Object != b.Object {
+			return a.Object < b.Object
+		}
+		return a.WorkStatus < b.WorkStatus
+	})
+	return report
+}
+
+func (r *Report) add(issueType, workStatus, manifestWork string, id objectIdentity, detail string) {
+	r.Issues = append(r.Issues, Issue{
+		Type:         issueType,
+		WorkStatus:   workStatus,
+		ManifestWork: manifestWork,
+		Object:       id.String(),
+		Detail:       detail,
+	})
+}
+
+// isStatusReported returns true if the fields of the status in a WorkStatus have the same values in
+// the status of the object, so that a projected status is not reported as different. The hashed values
+// and the lists with removed elements of a redacted status are not compared, nor are compressed statuses.
+func isStatusReported(workStatus *v1alpha1.WorkStatus, obj *unstructured.Unstructured) bool {
+	if len(workStatus.Status.Raw) == 0 {
+		return true
+	}
+	if workStatus.Truncation != nil && workStatus.Truncation.Encoding != "" {
+		return true
+	}
+	var reported any
+	if err := json.Unmarshal(workStatus.Status.Raw, &reported); err != nil {
+		return false
+	}
+	return isContained(reported, obj.Object["status"], workStatus.RedactedFields > 0)
+}
+
+func isContained(reported, actual any, redacted bool) bool {
+	switch reportedValue := reported.(type) {
+	case map[string]any:
+		actualMap, ok := actual.(map[string]any)
+		if !ok {
+			return false
+		}
+		for key, value := range reportedValue {
+			if !isContained(value, actualMap[key], redacted) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		actualSlice, ok := actual.([]any)
+		if !ok {
+			return false
+		}
+		if len(actualSlice) != len(reportedValue) {
+			return redacted && len(reportedValue) < len(actualSlice)
+		}
+		for i := range reportedValue {
+			if !isContained(reportedValue[i], actualSlice[i], redacted) {
+				return false
+			}
+		}
+		return true
+	case string:
+		if redacted && strings.HasPrefix(reportedValue, redaction.HashPrefix) {
+			return true
+		}
+		return reportedValue == actual
+	case float64:
+		// the numbers of unstructured objects are int64 or float64
+		switch actualValue := actual.(type) {
+		case int64:
+			return float64(actualValue) == reportedValue
+		case float64:
+			return actualValue == reportedValue
+		}
+		return false
+	default:
+		return equality.Semantic.DeepEqual(reported, actual)
+	}
+}
+
+func (r *Report) writeJSON(out io.Writer) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+func (r *Report) writeTable(out io.Writer) error {
+	scope := "hub only"
+	if r.InspectedWEC {
+		scope = "hub and cluster"
+	}
+	if _, err := fmt.Fprintf(out, "Cluster %s (%s): %d ManifestWorks, %d WorkStatuses, %d issues\n\n",
+		r.Cluster, scope, r.ManifestWorks, r.WorkStatuses, len(r.Issues)); err != nil {
+		return err
+	}
+	if len(r.Issues) == 0 {
+		return nil
+	}
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ISSUE\tWORKSTATUS\tMANIFESTWORK\tOBJECT\tDETAIL")
+	for _, issue := range r.Issues {
+		workStatus := issue.WorkStatus
+		if workStatus == "" {
+			workStatus = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", issue.Type, workStatus, issue.ManifestWork, issue.Object, issue.Detail)
+	}
+	return w.Flush()
+}
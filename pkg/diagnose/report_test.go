@@ -0,0 +1,290 @@
+package diagnose
+
+import (
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	workv1 "open-cluster-management.io/api/work/v1"
+
+	"github.com/kubestellar/ocm-status-addon/api/v1alpha1"
+	"github.com/kubestellar/ocm-status-addon/pkg/redaction"
+	"github.com/kubestellar/ocm-status-addon/pkg/tracking"
+	"github.com/kubestellar/ocm-status-addon/pkg/util"
+)
+
+// testManifestWork returns a ManifestWork at a generation, applied to the cluster at another one, with
+// a Deployment in its resource status
+func testManifestWork(generation, appliedGeneration int64) workv1.ManifestWork {
+	mw := workv1.ManifestWork{ObjectMeta: metav1.ObjectMeta{
+		Name:       "work",
+		Namespace:  "cluster1",
+		Generation: generation,
+		Labels:     map[string]string{"transport.kubestellar.io/originWdsName": "wds1"},
+	}}
+	mw.Status.Conditions = []metav1.Condition{
+		{Type: workv1.WorkApplied, Status: metav1.ConditionTrue, ObservedGeneration: appliedGeneration},
+	}
+	mw.Status.ResourceStatus.Manifests = []workv1.ManifestCondition{
+		{ResourceMeta: workv1.ManifestResourceMeta{Group: "apps", Version: "v1", Kind: "Deployment", Namespace: "default", Name: "nginx"}},
+	}
+	return mw
+}
+
+func testAppliedManifestWork() *workv1.AppliedManifestWork {
+	return &workv1.AppliedManifestWork{
+		ObjectMeta: metav1.ObjectMeta{Name: "hubhash-work", UID: types.UID("3f9a8c2e-1b7d-4e5f-9a0b-6c1d2e3f4a5b")},
+		Spec:       workv1.AppliedManifestWorkSpec{HubHash: "hubhash", ManifestWorkName: "work"},
+	}
+}
+
+func testDeployment(readyReplicas int64) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata": map[string]any{
+			"name":      "nginx",
+			"namespace": "default",
+			"ownerReferences": []any{map[string]any{
+				"apiVersion": workv1.GroupVersion.String(),
+				"kind":       util.AppliedManifestWorkKind,
+				"name":       "hubhash-work",
+				"uid":        "3f9a8c2e-1b7d-4e5f-9a0b-6c1d2e3f4a5b",
+			}},
+		},
+		"status": map[string]any{"readyReplicas": readyReplicas},
+	}}
+	return obj
+}
+
+func testWorkStatus(name, owner string, lastGeneration int64, status string) v1alpha1.WorkStatus {
+	workStatus := v1alpha1.WorkStatus{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "cluster1"},
+		Spec: v1alpha1.WorkStatusSpec{SourceRef: v1alpha1.SourceRef{
+			Group: "apps", Version: "v1", Kind: "Deployment", Namespace: "default", Name: "nginx",
+		}},
+		StatusDetails: v1alpha1.StatusDetails{LastGeneration: lastGeneration},
+	}
+	if owner != "" {
+		controller := true
+		workStatus.OwnerReferences = []metav1.OwnerReference{
+			{APIVersion: workv1.GroupVersion.String(), Kind: "ManifestWork", Name: owner, Controller: &controller},
+		}
+	}
+	if status != "" {
+		workStatus.Status = v1alpha1.RawStatus{RawExtension: runtime.RawExtension{Raw: []byte(status)}}
+	}
+	return workStatus
+}
+
+func TestDiagnose(t *testing.T) {
+	aw := testAppliedManifestWork()
+	expectedName := util.BuildWorkstatusName(*aw, testDeployment(1))
+	kubestellar, err := tracking.ParseManifestWorkSelector("transport.kubestellar.io/", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	noDeployments, err := tracking.ParseRules("apps/Deployment")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		state    clusterState
+		rules    tracking.Rules
+		selector tracking.ManifestWorkSelector
+		expected []Issue
+	}{
+		{
+			name:     "missing",
+			state:    clusterState{manifestWorks: []workv1.ManifestWork{testManifestWork(2, 2)}},
+			expected: []Issue{{Type: IssueMissing, ManifestWork: "work", Object: "apps/v1/Deployment/default/nginx", Detail: "the object has no WorkStatus"}},
+		},
+		{
+			name: "reported",
+			state: clusterState{
+				manifestWorks: []workv1.ManifestWork{testManifestWork(2, 2)},
+				workStatuses:  []v1alpha1.WorkStatus{testWorkStatus("status", "work", 2, "")},
+			},
+			expected: []Issue{},
+		},
+		{
+			name: "generation rolled out",
+			state: clusterState{
+				manifestWorks: []workv1.ManifestWork{testManifestWork(3, 2)},
+				workStatuses:  []v1alpha1.WorkStatus{testWorkStatus("status", "work", 2, "")},
+			},
+			expected: []Issue{},
+		},
+		{
+			name: "behind the applied generation",
+			state: clusterState{
+				manifestWorks: []workv1.ManifestWork{testManifestWork(3, 3)},
+				workStatuses:  []v1alpha1.WorkStatus{testWorkStatus("status", "work", 2, "")},
+			},
+			expected: []Issue{{Type: IssueStale, WorkStatus: "status", ManifestWork: "work", Object: "apps/v1/Deployment/default/nginx",
+				Detail: "the WorkStatus reports generation 2 of the ManifestWork, which is applied at generation 3"}},
+		},
+		{
+			name:     "not selected",
+			state:    clusterState{manifestWorks: []workv1.ManifestWork{testManifestWork(2, 2)}},
+			selector: tracking.ManifestWorkSelector{LabelKeyPrefixes: []string{"managed-by.kubestellar.io/"}},
+			expected: []Issue{},
+		},
+		{
+			name:     "not tracked",
+			state:    clusterState{manifestWorks: []workv1.ManifestWork{testManifestWork(2, 2)}},
+			rules:    tracking.Rules{Exclude: noDeployments},
+			expected: []Issue{},
+		},
+		{
+			name: "several WorkStatuses",
+			state: clusterState{
+				manifestWorks: []workv1.ManifestWork{testManifestWork(2, 2)},
+				workStatuses:  []v1alpha1.WorkStatus{testWorkStatus("a", "work", 2, ""), testWorkStatus("b", "work", 2, "")},
+			},
+			expected: []Issue{{Type: IssueMisnamed, WorkStatus: "b", ManifestWork: "work", Object: "apps/v1/Deployment/default/nginx",
+				Detail: "the object has several WorkStatuses"}},
+		},
+		{
+			name: "orphaned",
+			state: clusterState{
+				workStatuses: []v1alpha1.WorkStatus{testWorkStatus("status", "deleted", 2, "")},
+			},
+			expected: []Issue{{Type: IssueOrphaned, WorkStatus: "status", ManifestWork: "deleted", Object: "apps/v1/Deployment/default/nginx",
+				Detail: "the ManifestWork of the WorkStatus does not exist"}},
+		},
+		{
+			name: "not written by the agent",
+			state: clusterState{
+				workStatuses: []v1alpha1.WorkStatus{testWorkStatus("status", "", 2, "")},
+			},
+			expected: []Issue{},
+		},
+		{
+			name: "inspected and reported",
+			state: clusterState{
+				manifestWorks: []workv1.ManifestWork{testManifestWork(2, 2)},
+				workStatuses:  []v1alpha1.WorkStatus{testWorkStatus(expectedName, "work", 2, `{"readyReplicas":1}`)},
+				applied:       []appliedObject{{appliedManifestWork: aw, object: testDeployment(1)}},
+			},
+			expected: []Issue{},
+		},
+		{
+			name: "inspected with a different status",
+			state: clusterState{
+				manifestWorks: []workv1.ManifestWork{testManifestWork(2, 2)},
+				workStatuses:  []v1alpha1.WorkStatus{testWorkStatus(expectedName, "work", 2, `{"readyReplicas":1}`)},
+				applied:       []appliedObject{{appliedManifestWork: aw, object: testDeployment(3)}},
+			},
+			expected: []Issue{{Type: IssueStale, WorkStatus: expectedName, ManifestWork: "work", Object: "apps/v1/Deployment/default/nginx",
+				Detail: "the status in the WorkStatus differs from the status of the object"}},
+		},
+		{
+			name: "inspected with a legacy name",
+			state: clusterState{
+				manifestWorks: []workv1.ManifestWork{testManifestWork(2, 2)},
+				workStatuses: []v1alpha1.WorkStatus{
+					testWorkStatus("legacy", "work", 2, ""),
+					testWorkStatus(expectedName, "work", 2, ""),
+				},
+				applied: []appliedObject{{appliedManifestWork: aw, object: testDeployment(1)}},
+			},
+			expected: []Issue{{Type: IssueMisnamed, WorkStatus: "legacy", ManifestWork: "work", Object: "apps/v1/Deployment/default/nginx",
+				Detail: "the WorkStatus of the object is expected to be named " + expectedName}},
+		},
+		{
+			name: "inspected without the object",
+			state: clusterState{
+				manifestWorks: []workv1.ManifestWork{testManifestWork(2, 2)},
+				workStatuses:  []v1alpha1.WorkStatus{testWorkStatus(expectedName, "work", 2, "")},
+				applied:       []appliedObject{{appliedManifestWork: aw}},
+			},
+			expected: []Issue{{Type: IssueOrphaned, WorkStatus: expectedName, ManifestWork: "work", Object: "apps/v1/Deployment/default/nginx",
+				Detail: "the object is not applied to the cluster by the ManifestWork"}},
+		},
+		{
+			name: "selected by the label prefixes",
+			state: clusterState{
+				manifestWorks: []workv1.ManifestWork{testManifestWork(2, 2)},
+			},
+			selector: kubestellar,
+			expected: []Issue{{Type: IssueMissing, ManifestWork: "work", Object: "apps/v1/Deployment/default/nginx", Detail: "the object has no WorkStatus"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			report := diagnose("cluster1", &test.state, test.rules, test.selector)
+			if !reflect.DeepEqual(report.Issues, test.expected) {
+				t.Errorf("got issues %+v, expected %+v", report.Issues, test.expected)
+			}
+			if report.InspectedWEC != (test.state.applied != nil) {
+				t.Errorf("got InspectedWEC %t", report.InspectedWEC)
+			}
+		})
+	}
+}
+
+func TestIsContained(t *testing.T) {
+	actual := map[string]any{
+		"replicas":   int64(3),
+		"ratio":      0.5,
+		"phase":      "Running",
+		"ready":      true,
+		"conditions": []any{map[string]any{"type": "Available", "status": "True"}, map[string]any{"type": "Progressing"}},
+		"nested":     map[string]any{"token": "secret"},
+	}
+	tests := []struct {
+		name     string
+		reported any
+		redacted bool
+		expected bool
+	}{
+		{name: "same values", reported: map[string]any{"replicas": 3.0, "ratio": 0.5, "phase": "Running", "ready": true}, expected: true},
+		{name: "projected fields", reported: map[string]any{"phase": "Running"}, expected: true},
+		{name: "empty", reported: map[string]any{}, expected: true},
+		{name: "different number", reported: map[string]any{"replicas": 2.0}},
+		{name: "different float", reported: map[string]any{"ratio": 0.25}},
+		{name: "different string", reported: map[string]any{"phase": "Pending"}},
+		{name: "different bool", reported: map[string]any{"ready": false}},
+		{name: "missing field", reported: map[string]any{"missing": "value"}},
+		{name: "map instead of a value", reported: map[string]any{"phase": map[string]any{}}},
+		{name: "list instead of a value", reported: map[string]any{"phase": []any{}}},
+		{
+			name:     "same list",
+			reported: map[string]any{"conditions": []any{map[string]any{"type": "Available"}, map[string]any{"type": "Progressing"}}},
+			expected: true,
+		},
+		{name: "shorter list", reported: map[string]any{"conditions": []any{map[string]any{"type": "Available"}}}},
+		{
+			name:     "shorter list redacted",
+			reported: map[string]any{"conditions": []any{map[string]any{"type": "Available"}}},
+			redacted: true,
+			expected: true,
+		},
+		{
+			name:     "longer list redacted",
+			reported: map[string]any{"conditions": []any{map[string]any{}, map[string]any{}, map[string]any{}}},
+			redacted: true,
+		},
+		{name: "different element", reported: map[string]any{"conditions": []any{map[string]any{"type": "Progressing"}, map[string]any{}}}},
+		{name: "hashed value", reported: map[string]any{"nested": map[string]any{"token": redaction.HashPrefix + "0123"}}},
+		{
+			name:     "hashed value redacted",
+			reported: map[string]any{"nested": map[string]any{"token": redaction.HashPrefix + "0123"}},
+			redacted: true,
+			expected: true,
+		},
+		{name: "null", reported: map[string]any{"nested": nil}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if contained := isContained(test.reported, actual, test.redacted); contained != test.expected {
+				t.Errorf("got %t, expected %t", contained, test.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package health
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/kubestellar/ocm-status-addon/api/v1alpha1"
+)
+
+// condition is the assessed state of one of the health conditions
+type condition struct {
+	status  metav1.ConditionStatus
+	reason  string
+	message string
+}
+
+// assessment is the assessed state of the health conditions of an object
+type assessment struct {
+	available   condition
+	progressing condition
+	degraded    condition
+}
+
+type assessFunc func(obj *unstructured.Unstructured) (assessment, bool)
+
+// assessors are the functions assessing the health of the supported kinds.
+// The bool returned by a function is false when it does not apply to the object,
+// e.g. for Services that are not load balancers.
+var assessors = map[schema.GroupKind]assessFunc{
+	{Group: "apps", Kind: "Deployment"}:        assessDeployment,
+	{Group: "apps", Kind: "StatefulSet"}:       assessStatefulSet,
+	{Group: "apps", Kind: "DaemonSet"}:         assessDaemonSet,
+	{Group: "batch", Kind: "Job"}:              assessJob,
+	{Group: "", Kind: "Pod"}:                   assessPod,
+	{Group: "", Kind: "Service"}:               assessService,
+	{Group: "", Kind: "PersistentVolumeClaim"}: assessPersistentVolumeClaim,
+	{Group: "", Kind: "Namespace"}:             assessNamespace,
+}
+
+// Assess returns the health of an object, or nil if its kind is not supported.
+// The conditions have no transition time, which is set by Merge.
+func Assess(obj *unstructured.Unstructured) *v1alpha1.Health {
+	assess, ok := assessors[obj.GroupVersionKind().GroupKind()]
+	if !ok {
+		return nil
+	}
+	result, ok := assess(obj)
+	if !ok {
+		return nil
+	}
+	return &v1alpha1.Health{
+		Phase: phase(result),
+		Conditions: []metav1.Condition{
+			newCondition(v1alpha1.HealthConditionAvailable, result.available, obj.GetGeneration()),
+			newCondition(v1alpha1.HealthConditionProgressing, result.progressing, obj.GetGeneration()),
+			newCondition(v1alpha1.HealthConditionDegraded, result.degraded, obj.GetGeneration()),
+		},
+	}
+}
+
+// Merge returns the assessed health with the transition times of the previous health
+// for the conditions whose status did not change, and the current time for the others.
+func Merge(previous, assessed *v1alpha1.Health) *v1alpha1.Health {
+	if assessed == nil {
+		return nil
+	}
+	result := &v1alpha1.Health{Phase: assessed.Phase}
+	if previous != nil {
+		result.Conditions = append(result.Conditions, previous.Conditions...)
+	}
+	for _, c := range assessed.Conditions {
+		setCondition(&result.Conditions, c)
+	}
+	// drop the previous conditions that are not assessed anymore
+	conditions := result.Conditions[:0]
+	for _, c := range result.Conditions {
+		if findCondition(assessed.Conditions, c.Type) != nil {
+			conditions = append(conditions, c)
+		}
+	}
+	result.Conditions = conditions
+	return result
+}
+
+func setCondition(conditions *[]metav1.Condition, c metav1.Condition) {
+	existing := findCondition(*conditions, c.Type)
+	if existing == nil {
+		c.LastTransitionTime = metav1.Now()
+		*conditions = append(*conditions, c)
+		return
+	}
+	if existing.Status != c.Status {
+		c.LastTransitionTime = metav1.Now()
+	} else {
+		c.LastTransitionTime = existing.LastTransitionTime
+	}
+	*existing = c
+}
+
+func findCondition(conditions []metav1.Condition, conditionType string) *metav1.Condition {
+	for i := range conditions {
+		if conditions[i].Type == conditionType {
+			return &conditions[i]
+		}
+	}
+	return nil
+}
+
+func phase(result assessment) v1alpha1.HealthPhase {
+	switch {
+	case result.degraded.status == metav1.ConditionTrue:
+		return v1alpha1.HealthPhaseDegraded
+	case result.progressing.status == metav1.ConditionTrue:
+		return v1alpha1.HealthPhaseProgressing
+	case result.available.status == metav1.ConditionTrue:
+		return v1alpha1.HealthPhaseHealthy
+	default:
+		return v1alpha1.HealthPhaseUnknown
+	}
+}
+
+func newCondition(conditionType string, c condition, generation int64) metav1.Condition {
+	return metav1.Condition{
+		Type:               conditionType,
+		Status:             c.status,
+		ObservedGeneration: generation,
+		Reason:             c.reason,
+		Message:            c.message,
+	}
+}
+
+func isTrue(reason, message string) condition {
+	return condition{status: metav1.ConditionTrue, reason: reason, message: message}
+}
+
+func isFalse(reason, message string) condition {
+	return condition{status: metav1.ConditionFalse, reason: reason, message: message}
+}
+
+func isUnknown(reason, message string) condition {
+	return condition{status: metav1.ConditionUnknown, reason: reason, message: message}
+}
+
+// when returns a true condition when ok holds, and a false one otherwise
+func when(ok bool, trueReason, trueMessage, falseReason, falseMessage string) condition {
+	if ok {
+		return isTrue(trueReason, trueMessage)
+	}
+	return isFalse(falseReason, falseMessage)
+}
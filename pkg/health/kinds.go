@@ -0,0 +1,325 @@
+package health
+
+import (
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// reasons of the waiting containers that do not recover without intervention
+var failedContainerReasons = map[string]bool{
+	"CrashLoopBackOff":           true,
+	"ImagePullBackOff":           true,
+	"ErrImagePull":               true,
+	"InvalidImageName":           true,
+	"CreateContainerConfigError": true,
+	"CreateContainerError":       true,
+	"RunContainerError":          true,
+}
+
+var noFailure = isFalse("NoFailure", "no failure detected")
+
+func assessDeployment(obj *unstructured.Unstructured) (assessment, bool) {
+	desired := int64Field(obj, 1, "spec", "replicas")
+	replicas := int64Field(obj, 0, "status", "replicas")
+	updated := int64Field(obj, 0, "status", "updatedReplicas")
+	available := int64Field(obj, 0, "status", "availableReplicas")
+	result := assessment{degraded: noFailure}
+
+	if c, ok := getCondition(obj, "Available"); ok {
+		result.available = c
+	} else {
+		result.available = when(available >= desired,
+			"MinimumReplicasAvailable", fmt.Sprintf("%d of %d replicas available", available, desired),
+			"MinimumReplicasUnavailable", fmt.Sprintf("%d of %d replicas available", available, desired))
+	}
+
+	switch {
+	case !isGenerationObserved(obj):
+		result.progressing = isTrue("GenerationNotObserved", "the latest generation is not observed yet")
+	case updated < desired:
+		result.progressing = isTrue("RollingOut", fmt.Sprintf("%d of %d replicas updated", updated, desired))
+	case replicas > updated:
+		result.progressing = isTrue("RollingOut", fmt.Sprintf("%d old replicas pending termination", replicas-updated))
+	case available < updated:
+		result.progressing = isTrue("RollingOut", fmt.Sprintf("%d of %d updated replicas available", available, updated))
+	default:
+		result.progressing = isFalse("RolloutComplete", "all replicas are updated and available")
+	}
+
+	if c, ok := getCondition(obj, "Progressing"); ok && c.reason == "ProgressDeadlineExceeded" {
+		result.degraded = isTrue(c.reason, c.message)
+	} else if c, ok := getCondition(obj, "ReplicaFailure"); ok && c.status == "True" {
+		result.degraded = isTrue("ReplicaFailure", c.message)
+	}
+	return result, true
+}
+
+func assessStatefulSet(obj *unstructured.Unstructured) (assessment, bool) {
+	desired := int64Field(obj, 1, "spec", "replicas")
+	updated := int64Field(obj, 0, "status", "updatedReplicas")
+	ready := int64Field(obj, 0, "status", "readyReplicas")
+	available := int64Field(obj, ready, "status", "availableReplicas")
+	rollingUpdate := stringField(obj, "RollingUpdate", "spec", "updateStrategy", "type") == "RollingUpdate"
+	currentRevision := stringField(obj, "", "status", "currentRevision")
+	updateRevision := stringField(obj, "", "status", "updateRevision")
+	result := assessment{degraded: noFailure}
+
+	result.available = when(available >= desired,
+		"MinimumReplicasAvailable", fmt.Sprintf("%d of %d replicas available", available, desired),
+		"MinimumReplicasUnavailable", fmt.Sprintf("%d of %d replicas available", available, desired))
+
+	switch {
+	case !isGenerationObserved(obj):
+		result.progressing = isTrue("GenerationNotObserved", "the latest generation is not observed yet")
+	case rollingUpdate && updated < desired:
+		result.progressing = isTrue("RollingOut", fmt.Sprintf("%d of %d replicas updated", updated, desired))
+	case rollingUpdate && updateRevision != "" && currentRevision != updateRevision:
+		result.progressing = isTrue("RollingOut", "the update revision is not rolled out yet")
+	case ready < desired:
+		result.progressing = isTrue("ReplicasNotReady", fmt.Sprintf("%d of %d replicas ready", ready, desired))
+	default:
+		result.progressing = isFalse("RolloutComplete", "all replicas are updated and ready")
+	}
+	return result, true
+}
+
+func assessDaemonSet(obj *unstructured.Unstructured) (assessment, bool) {
+	desired := int64Field(obj, 0, "status", "desiredNumberScheduled")
+	updated := int64Field(obj, 0, "status", "updatedNumberScheduled")
+	available := int64Field(obj, 0, "status", "numberAvailable")
+	misscheduled := int64Field(obj, 0, "status", "numberMisscheduled")
+	rollingUpdate := stringField(obj, "RollingUpdate", "spec", "updateStrategy", "type") == "RollingUpdate"
+	result := assessment{degraded: noFailure}
+
+	result.available = when(available >= desired,
+		"AllPodsAvailable", fmt.Sprintf("%d of %d pods available", available, desired),
+		"PodsUnavailable", fmt.Sprintf("%d of %d pods available", available, desired))
+
+	switch {
+	case !isGenerationObserved(obj):
+		result.progressing = isTrue("GenerationNotObserved", "the latest generation is not observed yet")
+	case rollingUpdate && updated < desired:
+		result.progressing = isTrue("RollingOut", fmt.Sprintf("%d of %d pods updated", updated, desired))
+	case available < desired:
+		result.progressing = isTrue("PodsUnavailable", fmt.Sprintf("%d of %d pods available", available, desired))
+	default:
+		result.progressing = isFalse("RolloutComplete", "all pods are updated and available")
+	}
+
+	if misscheduled > 0 {
+		result.degraded = isTrue("PodsMisscheduled", fmt.Sprintf("%d pods running on nodes where they should not", misscheduled))
+	}
+	return result, true
+}
+
+func assessJob(obj *unstructured.Unstructured) (assessment, bool) {
+	active := int64Field(obj, 0, "status", "active")
+	result := assessment{degraded: noFailure}
+
+	if c, ok := getCondition(obj, "Failed"); ok && c.status == "True" {
+		result.available = isFalse("JobFailed", c.message)
+		result.progressing = isFalse("JobFailed", c.message)
+		result.degraded = isTrue(nonEmpty(c.reason, "JobFailed"), c.message)
+		return result, true
+	}
+	if c, ok := getCondition(obj, "Complete"); ok && c.status == "True" {
+		result.available = isTrue("JobComplete", "the job completed")
+		result.progressing = isFalse("JobComplete", "the job completed")
+		return result, true
+	}
+	result.available = isFalse("JobNotComplete", "the job did not complete yet")
+	if c, ok := getCondition(obj, "Suspended"); ok && c.status == "True" {
+		result.progressing = isFalse("JobSuspended", "the job is suspended")
+		return result, true
+	}
+	result.progressing = isTrue("JobRunning", fmt.Sprintf("%d active pods", active))
+	return result, true
+}
+
+func assessPod(obj *unstructured.Unstructured) (assessment, bool) {
+	podPhase := stringField(obj, "", "status", "phase")
+	result := assessment{degraded: noFailure}
+
+	switch podPhase {
+	case "Succeeded":
+		result.available = isTrue("PodSucceeded", "the pod terminated successfully")
+		result.progressing = isFalse("PodSucceeded", "the pod terminated successfully")
+		return result, true
+	case "Failed":
+		message := nonEmpty(stringField(obj, "", "status", "message"), "the pod failed")
+		result.available = isFalse("PodFailed", message)
+		result.progressing = isFalse("PodFailed", message)
+		result.degraded = isTrue(nonEmpty(stringField(obj, "", "status", "reason"), "PodFailed"), message)
+		return result, true
+	case "Pending", "Running":
+	default:
+		result.available = isUnknown("PodPhaseUnknown", "the state of the pod is unknown")
+		result.progressing = isUnknown("PodPhaseUnknown", "the state of the pod is unknown")
+		result.degraded = isUnknown("PodPhaseUnknown", "the state of the pod is unknown")
+		return result, true
+	}
+
+	if c, ok := getCondition(obj, "Ready"); ok && c.status == "True" {
+		result.available = isTrue("PodReady", "the pod is ready")
+		result.progressing = isFalse("PodReady", "the pod is ready")
+	} else {
+		result.available = isFalse("PodNotReady", "the pod is not ready")
+		result.progressing = isTrue("Pod"+podPhase, "the pod is "+strings.ToLower(podPhase)+" and not ready")
+	}
+	if reason, message, failed := failedContainer(obj); failed {
+		result.degraded = isTrue(reason, message)
+	}
+	return result, true
+}
+
+// failedContainer returns the reason and message of a container of a pod that is waiting
+// for a reason that does not recover without intervention.
+func failedContainer(obj *unstructured.Unstructured) (string, string, bool) {
+	for _, field := range []string{"initContainerStatuses", "containerStatuses"} {
+		statuses, _, _ := unstructured.NestedSlice(obj.Object, "status", field)
+		for _, s := range statuses {
+			status, ok := s.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			name, _, _ := unstructured.NestedString(status, "name")
+			reason, _, _ := unstructured.NestedString(status, "state", "waiting", "reason")
+			if failedContainerReasons[reason] {
+				message, _, _ := unstructured.NestedString(status, "state", "waiting", "message")
+				return reason, nonEmpty(message, "container "+name+" is in "+reason), true
+			}
+		}
+	}
+	return "", "", false
+}
+
+func assessService(obj *unstructured.Unstructured) (assessment, bool) {
+	if stringField(obj, "", "spec", "type") != "LoadBalancer" {
+		return assessment{}, false
+	}
+	ingress, _, _ := unstructured.NestedSlice(obj.Object, "status", "loadBalancer", "ingress")
+	provisioned := len(ingress) > 0
+	return assessment{
+		available: when(provisioned,
+			"LoadBalancerProvisioned", "the load balancer is provisioned",
+			"LoadBalancerPending", "the load balancer is not provisioned yet"),
+		progressing: when(!provisioned,
+			"LoadBalancerPending", "the load balancer is not provisioned yet",
+			"LoadBalancerProvisioned", "the load balancer is provisioned"),
+		degraded: noFailure,
+	}, true
+}
+
+func assessPersistentVolumeClaim(obj *unstructured.Unstructured) (assessment, bool) {
+	switch claimPhase := stringField(obj, "", "status", "phase"); claimPhase {
+	case "Bound":
+		return assessment{
+			available:   isTrue("ClaimBound", "the claim is bound"),
+			progressing: isFalse("ClaimBound", "the claim is bound"),
+			degraded:    noFailure,
+		}, true
+	case "Pending":
+		return assessment{
+			available:   isFalse("ClaimPending", "the claim is not bound yet"),
+			progressing: isTrue("ClaimPending", "the claim is not bound yet"),
+			degraded:    noFailure,
+		}, true
+	case "Lost":
+		return assessment{
+			available:   isFalse("ClaimLost", "the bound volume is lost"),
+			progressing: isFalse("ClaimLost", "the bound volume is lost"),
+			degraded:    isTrue("ClaimLost", "the bound volume is lost"),
+		}, true
+	default:
+		return assessment{
+			available:   isUnknown("ClaimPhaseUnknown", "the phase of the claim is unknown"),
+			progressing: isUnknown("ClaimPhaseUnknown", "the phase of the claim is unknown"),
+			degraded:    isUnknown("ClaimPhaseUnknown", "the phase of the claim is unknown"),
+		}, true
+	}
+}
+
+func assessNamespace(obj *unstructured.Unstructured) (assessment, bool) {
+	result := assessment{degraded: noFailure}
+	if stringField(obj, "", "status", "phase") == "Terminating" {
+		result.available = isFalse("NamespaceTerminating", "the namespace is terminating")
+		result.progressing = isTrue("NamespaceTerminating", "the namespace is terminating")
+	} else {
+		result.available = isTrue("NamespaceActive", "the namespace is active")
+		result.progressing = isFalse("NamespaceActive", "the namespace is active")
+	}
+	// the namespace controller reports failures to delete the content with *Failure conditions
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, c := range conditions {
+		cond, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		conditionType, _, _ := unstructured.NestedString(cond, "type")
+		status, _, _ := unstructured.NestedString(cond, "status")
+		if strings.HasSuffix(conditionType, "Failure") && status == "True" {
+			message, _, _ := unstructured.NestedString(cond, "message")
+			result.degraded = isTrue(conditionType, message)
+			break
+		}
+	}
+	return result, true
+}
+
+// getCondition returns a condition from the status of an object
+func getCondition(obj *unstructured.Unstructured, conditionType string) (condition, bool) {
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, c := range conditions {
+		cond, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if t, _, _ := unstructured.NestedString(cond, "type"); t != conditionType {
+			continue
+		}
+		status, _, _ := unstructured.NestedString(cond, "status")
+		reason, _, _ := unstructured.NestedString(cond, "reason")
+		message, _, _ := unstructured.NestedString(cond, "message")
+		return condition{status: conditionStatus(status), reason: nonEmpty(reason, conditionType), message: message}, true
+	}
+	return condition{}, false
+}
+
+func conditionStatus(status string) metav1.ConditionStatus {
+	switch status {
+	case string(metav1.ConditionTrue), string(metav1.ConditionFalse):
+		return metav1.ConditionStatus(status)
+	default:
+		return metav1.ConditionUnknown
+	}
+}
+
+func isGenerationObserved(obj *unstructured.Unstructured) bool {
+	return int64Field(obj, 0, "status", "observedGeneration") >= obj.GetGeneration()
+}
+
+func int64Field(obj *unstructured.Unstructured, defaultValue int64, fields ...string) int64 {
+	value, found, err := unstructured.NestedInt64(obj.Object, fields...)
+	if err != nil || !found {
+		return defaultValue
+	}
+	return value
+}
+
+func stringField(obj *unstructured.Unstructured, defaultValue string, fields ...string) string {
+	value, found, err := unstructured.NestedString(obj.Object, fields...)
+	if err != nil || !found {
+		return defaultValue
+	}
+	return value
+}
+
+func nonEmpty(value, defaultValue string) string {
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
@@ -28,6 +28,8 @@ type NoOpReconciler struct {
 
 //+kubebuilder:rbac:groups=control.kubestellar.io,resources=workstatuses,verbs=get;list;watch;create;update;delete;patch
 //+kubebuilder:rbac:groups=control.kubestellar.io,resources=workstatuses/status,verbs=update;patch
+//+kubebuilder:rbac:groups=control.kubestellar.io,resources=aggregatedworkstatuses,verbs=get;list;watch;create;update;delete;patch
+//+kubebuilder:rbac:groups=control.kubestellar.io,resources=aggregatedworkstatuses/status,verbs=update;patch
 //+kubebuilder:rbac:groups="",resources=configmaps;events,verbs=get;list;watch;create;update;delete;deletecollection;patch
 //+kubebuilder:rbac:groups=coordination.k8s.io,resources=leases,verbs=get;list;watch;create;update;patch
 //+kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=roles;rolebindings,verbs=get;list;watch;create;update;delete
@@ -0,0 +1,230 @@
+package mapping
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/metadata"
+	"k8s.io/client-go/metadata/metadatainformer"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+// minimum interval between the refreshes of a group caused by mapping misses, so that
+// repeated lookups of kinds that do not exist do not flood the API server with discovery
+const minMissRefreshInterval = 10 * time.Second
+
+var (
+	crdGVR        = schema.GroupVersionResource{Group: "apiextensions.k8s.io", Version: "v1", Resource: "customresourcedefinitions"}
+	apiServiceGVR = schema.GroupVersionResource{Group: "apiregistration.k8s.io", Version: "v1", Resource: "apiservices"}
+)
+
+// RESTMapper is a RESTMapper built from a full discovery at creation, and then kept up to date by
+// refreshing the discovery of a single group when a CustomResourceDefinition or an APIService of the
+// group changes, or when a mapping in the group is not found. A lookup that finds no match is retried
+// once after refreshing the group.
+type RESTMapper struct {
+	discovery discovery.DiscoveryInterface
+
+	lock            sync.RWMutex
+	groups          []*restmapper.APIGroupResources
+	delegate        meta.RESTMapper
+	lastMissRefresh map[string]time.Time
+}
+
+var _ meta.RESTMapper = &RESTMapper{}
+
+// NewRESTMapper returns a RESTMapper initialized with a full discovery
+func NewRESTMapper(discoveryClient discovery.DiscoveryInterface) (*RESTMapper, error) {
+	groups, err := restmapper.GetAPIGroupResources(discoveryClient)
+	if err != nil {
+		return nil, err
+	}
+	return &RESTMapper{
+		discovery:       discoveryClient,
+		groups:          groups,
+		delegate:        restmapper.NewDiscoveryRESTMapper(groups),
+		lastMissRefresh: map[string]time.Time{},
+	}, nil
+}
+
+// RunInvalidation refreshes the groups of the CustomResourceDefinitions and APIServices that are
+// added, updated or deleted, until the stopper is closed. Only the metadata of these objects is
+// watched, as their names tell their groups.
+func (m *RESTMapper) RunInvalidation(client metadata.Interface, stopper <-chan struct{}) {
+	factory := metadatainformer.NewSharedInformerFactory(client, 0)
+	for _, gvr := range []schema.GroupVersionResource{crdGVR, apiServiceGVR} {
+		_, err := factory.ForResource(gvr).Informer().AddEventHandler(cache.ResourceEventHandlerDetailedFuncs{
+			AddFunc: func(obj interface{}, isInInitialList bool) {
+				// the initial list matches the full discovery done at creation
+				if !isInInitialList {
+					m.invalidateFor(obj)
+				}
+			},
+			UpdateFunc: func(_, obj interface{}) { m.invalidateFor(obj) },
+			DeleteFunc: m.invalidateFor,
+		})
+		if err != nil {
+			klog.ErrorS(err, "could not add event handler for discovery invalidation", "resource", gvr.String())
+		}
+	}
+	factory.Start(stopper)
+}
+
+// invalidateFor refreshes the group of a CustomResourceDefinition, named <plural>.<group>,
+// or of an APIService, named <version>.<group>
+func (m *RESTMapper) invalidateFor(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	mObj, ok := obj.(metav1.Object)
+	if !ok {
+		return
+	}
+	_, group, found := strings.Cut(mObj.GetName(), ".")
+	if !found {
+		return
+	}
+	if err := m.RefreshGroup(group); err != nil {
+		klog.ErrorS(err, "could not refresh discovery for group", "group", group)
+	}
+}
+
+// RefreshGroup replaces the discovery information of a group with the one currently served
+func (m *RESTMapper) RefreshGroup(group string) error {
+	groupResources, err := m.discoverGroup(group)
+	if err != nil {
+		return err
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	groups := make([]*restmapper.APIGroupResources, 0, len(m.groups)+1)
+	replaced := false
+	for _, existing := range m.groups {
+		if existing.Group.Name != group {
+			groups = append(groups, existing)
+			continue
+		}
+		// keep the position of the group, which sets its priority
+		if groupResources != nil {
+			groups = append(groups, groupResources)
+		}
+		replaced = true
+	}
+	if !replaced && groupResources != nil {
+		groups = append(groups, groupResources)
+	}
+	m.groups = groups
+	m.delegate = restmapper.NewDiscoveryRESTMapper(groups)
+	klog.V(2).InfoS("Refreshed discovery for group", "group", group, "served", groupResources != nil)
+	return nil
+}
+
+// discoverGroup returns the discovery information of a group, or nil if the group is not served
+func (m *RESTMapper) discoverGroup(group string) (*restmapper.APIGroupResources, error) {
+	serverGroups, err := m.discovery.ServerGroups()
+	if err != nil {
+		return nil, err
+	}
+	for i := range serverGroups.Groups {
+		apiGroup := serverGroups.Groups[i]
+		if apiGroup.Name != group {
+			continue
+		}
+		result := &restmapper.APIGroupResources{
+			Group:              apiGroup,
+			VersionedResources: map[string][]metav1.APIResource{},
+		}
+		for _, version := range apiGroup.Versions {
+			resources, err := m.discovery.ServerResourcesForGroupVersion(version.GroupVersion)
+			if err != nil {
+				// a version of an aggregated API may not be available
+				if apierrors.IsNotFound(err) || apierrors.IsServiceUnavailable(err) {
+					continue
+				}
+				return nil, err
+			}
+			result.VersionedResources[version.Version] = resources.APIResources
+		}
+		return result, nil
+	}
+	return nil, nil
+}
+
+func (m *RESTMapper) getDelegate() meta.RESTMapper {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return m.delegate
+}
+
+// retryOnNoMatch runs a lookup and, if it finds no match, refreshes the group and runs it again
+func retryOnNoMatch[T any](m *RESTMapper, group string, lookup func(meta.RESTMapper) (T, error)) (T, error) {
+	result, err := lookup(m.getDelegate())
+	if err == nil || !meta.IsNoMatchError(err) || !m.shouldRefreshOnMiss(group) {
+		return result, err
+	}
+	if refreshErr := m.RefreshGroup(group); refreshErr != nil {
+		klog.ErrorS(refreshErr, "could not refresh discovery for group", "group", group)
+		return result, err
+	}
+	return lookup(m.getDelegate())
+}
+
+// shouldRefreshOnMiss returns false if the group was refreshed because of a miss too recently
+func (m *RESTMapper) shouldRefreshOnMiss(group string) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if last, ok := m.lastMissRefresh[group]; ok && time.Since(last) < minMissRefreshInterval {
+		return false
+	}
+	m.lastMissRefresh[group] = time.Now()
+	return true
+}
+
+func (m *RESTMapper) KindFor(resource schema.GroupVersionResource) (schema.GroupVersionKind, error) {
+	return retryOnNoMatch(m, resource.Group, func(d meta.RESTMapper) (schema.GroupVersionKind, error) {
+		return d.KindFor(resource)
+	})
+}
+
+func (m *RESTMapper) KindsFor(resource schema.GroupVersionResource) ([]schema.GroupVersionKind, error) {
+	return retryOnNoMatch(m, resource.Group, func(d meta.RESTMapper) ([]schema.GroupVersionKind, error) {
+		return d.KindsFor(resource)
+	})
+}
+
+func (m *RESTMapper) ResourceFor(input schema.GroupVersionResource) (schema.GroupVersionResource, error) {
+	return retryOnNoMatch(m, input.Group, func(d meta.RESTMapper) (schema.GroupVersionResource, error) {
+		return d.ResourceFor(input)
+	})
+}
+
+func (m *RESTMapper) ResourcesFor(input schema.GroupVersionResource) ([]schema.GroupVersionResource, error) {
+	return retryOnNoMatch(m, input.Group, func(d meta.RESTMapper) ([]schema.GroupVersionResource, error) {
+		return d.ResourcesFor(input)
+	})
+}
+
+func (m *RESTMapper) RESTMapping(gk schema.GroupKind, versions ...string) (*meta.RESTMapping, error) {
+	return retryOnNoMatch(m, gk.Group, func(d meta.RESTMapper) (*meta.RESTMapping, error) {
+		return d.RESTMapping(gk, versions...)
+	})
+}
+
+func (m *RESTMapper) RESTMappings(gk schema.GroupKind, versions ...string) ([]*meta.RESTMapping, error) {
+	return retryOnNoMatch(m, gk.Group, func(d meta.RESTMapper) ([]*meta.RESTMapping, error) {
+		return d.RESTMappings(gk, versions...)
+	})
+}
+
+func (m *RESTMapper) ResourceSingularizer(resource string) (string, error) {
+	return m.getDelegate().ResourceSingularizer(resource)
+}
@@ -21,6 +21,12 @@ import (
 	"net"
 	"net/http"
 
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 	"k8s.io/apiserver/pkg/server/mux"
 	"k8s.io/apiserver/pkg/server/routes"
 	"k8s.io/component-base/metrics/legacyregistry"
@@ -30,12 +36,14 @@ import (
 )
 
 type FlagSet interface {
+	BoolVar(p *bool, name string, value bool, usage string)
 	Float64Var(p *float64, name string, value float64, usage string)
 	IntVar(p *int, name string, value int, usage string)
 	StringVar(p *string, name string, value string, usage string)
 }
 
-// ObservabilityOptions covers offering Prometheus metrics and /debug/pprof .
+// ObservabilityOptions covers offering Prometheus metrics and /debug/pprof,
+// and exporting OpenTelemetry traces with OTLP.
 type ObservabilityOptions[FS FlagSet] struct {
 
 	// MetricsBindAddr is the local `:$port` or `$host:$port`
@@ -49,6 +57,18 @@ type ObservabilityOptions[FS FlagSet] struct {
 	// More specifically, this is the sort of string that can
 	// be used as the `Addr` in a `net/http.Server`.
 	PprofBindAddr string
+
+	// TracingEndpoint is the `$host:$port` of the OTLP gRPC collector
+	// that the traces are exported to. Tracing is disabled when empty.
+	TracingEndpoint string
+
+	// TracingInsecure disables TLS for the connection to the collector.
+	TracingInsecure bool
+
+	// TracingSamplingRatio is the fraction of the traces started by the
+	// process that are sampled. Traces continued from a parent follow
+	// the sampling decision of the parent.
+	TracingSamplingRatio float64
 }
 
 func (opts *ObservabilityOptions[FS]) AddToFlagSet(flags FS) {
@@ -56,6 +76,39 @@ func (opts *ObservabilityOptions[FS]) AddToFlagSet(flags FS) {
 	flags.StringVar(&opts.PprofBindAddr, "pprof-bind-addr", opts.PprofBindAddr, "[host]:port at which to listen for HTTP requests for go /debug/pprof requests")
 }
 
+// AddTracingToFlagSet adds the flags of the tracing options, for the processes that produce traces.
+func (opts *ObservabilityOptions[FS]) AddTracingToFlagSet(flags FS) {
+	flags.StringVar(&opts.TracingEndpoint, "tracing-endpoint", opts.TracingEndpoint, "host:port of the OTLP gRPC collector to export traces to, empty to disable tracing")
+	flags.BoolVar(&opts.TracingInsecure, "tracing-insecure", opts.TracingInsecure, "Disable TLS for the connection to the OTLP collector")
+	flags.Float64Var(&opts.TracingSamplingRatio, "tracing-sampling-ratio", opts.TracingSamplingRatio, "Fraction of the new traces that are sampled")
+}
+
+// StartTracing sets up the global OpenTelemetry tracer provider, exporting to the configured
+// collector, and the W3C trace context propagator. It does nothing when no endpoint is set.
+// The returned function flushes and stops the export.
+func (opts *ObservabilityOptions[FS]) StartTracing(ctx context.Context, serviceName string) (func(context.Context) error, error) {
+	if opts.TracingEndpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+	exporterOptions := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(opts.TracingEndpoint)}
+	if opts.TracingInsecure {
+		exporterOptions = append(exporterOptions, otlptracegrpc.WithInsecure())
+	}
+	exporter, err := otlptracegrpc.New(ctx, exporterOptions...)
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(opts.TracingSamplingRatio))),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(serviceName))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	klog.FromContext(ctx).Info("Exporting traces", "endpoint", opts.TracingEndpoint, "samplingRatio", opts.TracingSamplingRatio)
+	return provider.Shutdown, nil
+}
+
 func (opts *ObservabilityOptions[FS]) StartServing(ctx context.Context) {
 	logger := klog.FromContext(ctx)
 	go func() {
@@ -2,11 +2,14 @@ package ocm
 
 import (
 	"context"
+	"crypto/sha256"
 	"fmt"
 
 	"github.com/kubestellar/ocm-status-addon/pkg/util"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/tools/cache"
@@ -82,12 +85,10 @@ func GetAppliedManifestWork(obj runtime.Object, listers *util.SafeMap) (*workv1.
 		return nil, fmt.Errorf("not managed by AppliedManifestWork")
 	}
 
-	key := util.KeyForGroupVersionKind(workv1.GroupVersion.Group, workv1.GroupVersion.Version, util.AppliedManifestWorkKind)
-	pListerIntf, _ := listers.Get(key)
-	if pListerIntf == nil {
-		return nil, fmt.Errorf("could not get lister for key %s", key)
+	lister, err := getAppliedManifestWorkLister(listers)
+	if err != nil {
+		return nil, err
 	}
-	lister := pListerIntf.(cache.GenericLister)
 	o, err := lister.Get(aName)
 	if err != nil {
 		return nil, fmt.Errorf("could not find applied manifest %s: %s", aName, err)
@@ -100,3 +101,107 @@ func GetAppliedManifestWork(obj runtime.Object, listers *util.SafeMap) (*workv1.
 
 	return aWork, nil
 }
+
+// HubHash returns the hash identifying a hub in the AppliedManifestWorks, which is computed by the
+// work agent from the URL of the API server of the hub
+func HubHash(hubServer string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(hubServer)))
+}
+
+// ListAppliedManifestWorks returns the AppliedManifestWorks in the local cache that belong to the hub
+// with the given hash.
+func ListAppliedManifestWorks(listers *util.SafeMap, hubHash string) ([]*workv1.AppliedManifestWork, error) {
+	lister, err := getAppliedManifestWorkLister(listers)
+	if err != nil {
+		return nil, err
+	}
+	objs, err := lister.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+
+	aWorks := []*workv1.AppliedManifestWork{}
+	for _, o := range objs {
+		aWork, err := ToAppliedManifestWork(o.(*unstructured.Unstructured))
+		if err != nil {
+			return nil, fmt.Errorf("could not convert object to applied manifest: %s", err)
+		}
+		if aWork.Spec.HubHash != hubHash {
+			continue
+		}
+		aWorks = append(aWorks, aWork)
+	}
+	return aWorks, nil
+}
+
+// ListAppliedManifestWorksForManifestWork returns the AppliedManifestWorks in the local cache
+// that were created by the work agent for the ManifestWork with the given name on the hub with the given hash.
+func ListAppliedManifestWorksForManifestWork(listers *util.SafeMap, hubHash, manifestWorkName string) ([]*workv1.AppliedManifestWork, error) {
+	all, err := ListAppliedManifestWorks(listers, hubHash)
+	if err != nil {
+		return nil, err
+	}
+
+	aWorks := []*workv1.AppliedManifestWork{}
+	for _, aWork := range all {
+		if aWork.Spec.ManifestWorkName == manifestWorkName {
+			aWorks = append(aWorks, aWork)
+		}
+	}
+	return aWorks, nil
+}
+
+func getAppliedManifestWorkLister(listers *util.SafeMap) (cache.GenericLister, error) {
+	key := util.KeyForGroupVersionKind(workv1.GroupVersion.Group, workv1.GroupVersion.Version, util.AppliedManifestWorkKind)
+	pListerIntf, _ := listers.Get(key)
+	if pListerIntf == nil {
+		return nil, fmt.Errorf("could not get lister for key %s", key)
+	}
+	return pListerIntf.(cache.GenericLister), nil
+}
+
+// GetStatusDetails returns the generation of the ManifestWork that reached the WEC, that is the
+// generation observed by the work agent when it last reported the Applied condition, and whether
+// that generation was successfully applied and is available for the given object.
+// The per-manifest conditions are used when the work agent reports them for the object,
+// otherwise the conditions of the whole ManifestWork are used.
+// A zero generation means that the work agent has not reported on the ManifestWork yet.
+func GetStatusDetails(manifestWork *workv1.ManifestWork, obj runtime.Object) (int64, bool) {
+	appliedCondition := meta.FindStatusCondition(manifestWork.Status.Conditions, workv1.WorkApplied)
+	if appliedCondition == nil {
+		return 0, false
+	}
+	generation := appliedCondition.ObservedGeneration
+
+	conditions := manifestWork.Status.Conditions
+	if manifestCondition := findManifestCondition(manifestWork, obj); manifestCondition != nil {
+		conditions = manifestCondition.Conditions
+	}
+
+	isApplied := isConditionTrueForGeneration(conditions, workv1.ManifestApplied, generation) &&
+		isConditionTrueForGeneration(conditions, workv1.ManifestAvailable, generation)
+	return generation, isApplied
+}
+
+func findManifestCondition(manifestWork *workv1.ManifestWork, obj runtime.Object) *workv1.ManifestCondition {
+	mObj := obj.(metav1.Object)
+	gvk := obj.GetObjectKind().GroupVersionKind()
+	for i, manifest := range manifestWork.Status.ResourceStatus.Manifests {
+		if manifest.ResourceMeta.Group == gvk.Group &&
+			manifest.ResourceMeta.Kind == gvk.Kind &&
+			manifest.ResourceMeta.Namespace == mObj.GetNamespace() &&
+			manifest.ResourceMeta.Name == mObj.GetName() {
+			return &manifestWork.Status.ResourceStatus.Manifests[i]
+		}
+	}
+	return nil
+}
+
+// a condition set for an older generation does not tell anything about the current one
+func isConditionTrueForGeneration(conditions []metav1.Condition, conditionType string, generation int64) bool {
+	condition := meta.FindStatusCondition(conditions, conditionType)
+	if condition == nil || condition.Status != metav1.ConditionTrue {
+		return false
+	}
+	return condition.ObservedGeneration == 0 || condition.ObservedGeneration == generation
+}
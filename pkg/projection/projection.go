@@ -0,0 +1,226 @@
+package projection
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/google/cel-go/cel"
+	"google.golang.org/protobuf/types/known/structpb"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/util/jsonpath"
+	"sigs.k8s.io/yaml"
+)
+
+// celObjectVariable is the name of the variable holding the object in CEL expressions
+const celObjectVariable = "object"
+
+// The CEL expressions are evaluated on every reconcile of the objects of their kind, so that an expensive
+// expression is stopped rather than stalling the workers: its cost is limited, as for the validation rules
+// of CRDs, and its evaluation is interrupted after a timeout.
+const (
+	celCostLimit         = 1000000
+	celInterruptInterval = 100
+	celEvalTimeout       = 100 * time.Millisecond
+)
+
+// Field is a field of a projected status. Its value is given by either a JSONPath
+// (e.g. "{.status.readyReplicas}") or a CEL expression (e.g. "object.status.readyReplicas"),
+// evaluated on the whole object. A field with no value is not included in the projected status,
+// and JSONPaths with more than one result give a list.
+type Field struct {
+	Name     string `json:"name"`
+	JSONPath string `json:"jsonPath,omitempty"`
+	CEL      string `json:"cel,omitempty"`
+}
+
+// Projection lists the fields reported in the status of the objects of a kind. A projection
+// WhenOversized is only applied to the statuses that exceed the size budget of the agent.
+type Projection struct {
+	Group         string  `json:"group"`
+	Kind          string  `json:"kind"`
+	Fields        []Field `json:"fields"`
+	WhenOversized bool    `json:"whenOversized,omitempty"`
+}
+
+// Config is the content of a status projection file.
+type Config struct {
+	Projections []Projection `json:"projections"`
+}
+
+// Projector shapes the status of objects of the kinds with a projection.
+type Projector struct {
+	projections map[schema.GroupKind]compiledProjection
+}
+
+type compiledProjection struct {
+	fields        []compiledField
+	whenOversized bool
+}
+
+type compiledField struct {
+	name     string
+	jsonPath *jsonpath.JSONPath
+	program  cel.Program
+}
+
+// ReadFile reads the projections in a YAML file and returns a projector for them, together
+// with the content of the file. A file that does not exist is read as no projections.
+func ReadFile(file string) (*Projector, []byte, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return &Projector{}, nil, nil
+		}
+		return nil, nil, err
+	}
+	config := Config{}
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return nil, nil, fmt.Errorf("invalid status projection file %s: %w", file, err)
+	}
+	projector, err := NewProjector(config)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid status projection file %s: %w", file, err)
+	}
+	return projector, data, nil
+}
+
+// NewProjector parses the JSONPaths and compiles the CEL expressions of the projections.
+func NewProjector(config Config) (*Projector, error) {
+	env, err := cel.NewEnv(cel.Variable(celObjectVariable, cel.DynType))
+	if err != nil {
+		return nil, err
+	}
+
+	projector := &Projector{projections: map[schema.GroupKind]compiledProjection{}}
+	for _, projection := range config.Projections {
+		gk := schema.GroupKind{Group: projection.Group, Kind: projection.Kind}
+		if _, ok := projector.projections[gk]; ok {
+			return nil, fmt.Errorf("duplicate projection for %s", gk)
+		}
+		fields := []compiledField{}
+		for _, field := range projection.Fields {
+			compiled, err := compileField(env, field)
+			if err != nil {
+				return nil, fmt.Errorf("invalid field %q for %s: %w", field.Name, gk, err)
+			}
+			fields = append(fields, compiled)
+		}
+		projector.projections[gk] = compiledProjection{fields: fields, whenOversized: projection.WhenOversized}
+	}
+	return projector, nil
+}
+
+func compileField(env *cel.Env, field Field) (compiledField, error) {
+	compiled := compiledField{name: field.Name}
+	if field.Name == "" {
+		return compiled, fmt.Errorf("name must not be empty")
+	}
+	switch {
+	case field.JSONPath != "" && field.CEL == "":
+		compiled.jsonPath = jsonpath.New(field.Name).AllowMissingKeys(true)
+		if err := compiled.jsonPath.Parse(field.JSONPath); err != nil {
+			return compiled, err
+		}
+	case field.CEL != "" && field.JSONPath == "":
+		ast, issues := env.Compile(field.CEL)
+		if issues != nil && issues.Err() != nil {
+			return compiled, issues.Err()
+		}
+		program, err := env.Program(ast, cel.CostLimit(celCostLimit), cel.InterruptCheckFrequency(celInterruptInterval))
+		if err != nil {
+			return compiled, err
+		}
+		compiled.program = program
+	default:
+		return compiled, fmt.Errorf("exactly one of jsonPath and cel must be set")
+	}
+	return compiled, nil
+}
+
+// HasProjection returns true if there is a projection for the given kind.
+func (p *Projector) HasProjection(gk schema.GroupKind) bool {
+	_, ok := p.projections[gk]
+	return ok
+}
+
+// Project returns the projected status of an object. The returned bool is false if there
+// is no projection for the kind of the object, or if the projection is only applied to
+// oversized statuses. Encoding the returned map to JSON gives the same result for the same
+// field values, as keys are sorted.
+func (p *Projector) Project(obj *unstructured.Unstructured) (map[string]interface{}, bool, error) {
+	return p.project(obj, false)
+}
+
+// ProjectOversized returns the projected status of an object with an oversized status. The returned
+// bool is false if there is no projection applied only to oversized statuses for the kind of the object.
+func (p *Projector) ProjectOversized(obj *unstructured.Unstructured) (map[string]interface{}, bool, error) {
+	return p.project(obj, true)
+}
+
+func (p *Projector) project(obj *unstructured.Unstructured, oversized bool) (map[string]interface{}, bool, error) {
+	projection, ok := p.projections[obj.GroupVersionKind().GroupKind()]
+	if !ok || projection.whenOversized != oversized {
+		return nil, false, nil
+	}
+	projected := map[string]interface{}{}
+	for _, field := range projection.fields {
+		value, ok, err := field.evaluate(obj)
+		if err != nil {
+			return nil, true, fmt.Errorf("could not evaluate field %q: %w", field.name, err)
+		}
+		if ok {
+			projected[field.name] = value
+		}
+	}
+	return projected, true, nil
+}
+
+func (f compiledField) evaluate(obj *unstructured.Unstructured) (interface{}, bool, error) {
+	if f.jsonPath != nil {
+		results, err := f.jsonPath.FindResults(obj.Object)
+		if err != nil {
+			return nil, false, err
+		}
+		values := []interface{}{}
+		for _, result := range results {
+			for _, value := range result {
+				values = append(values, value.Interface())
+			}
+		}
+		switch len(values) {
+		case 0:
+			return nil, false, nil
+		case 1:
+			return values[0], true, nil
+		default:
+			return values, true, nil
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), celEvalTimeout)
+	defer cancel()
+	out, _, err := f.program.ContextEval(ctx, map[string]interface{}{celObjectVariable: obj.Object})
+	if err != nil {
+		// a missing field gives no value, other errors show a broken expression
+		if isNoSuchKey(err) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	native, err := out.ConvertToNative(reflect.TypeOf(&structpb.Value{}))
+	if err != nil {
+		return nil, false, err
+	}
+	return native.(*structpb.Value).AsInterface(), true, nil
+}
+
+// isNoSuchKey returns true if a CEL evaluation error is the selection of a missing field or map key
+func isNoSuchKey(err error) bool {
+	return strings.HasPrefix(err.Error(), "no such key:")
+}
@@ -0,0 +1,118 @@
+package projection
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func testObject() *unstructured.Unstructured {
+	items := []interface{}{}
+	for i := 0; i < 2000; i++ {
+		items = append(items, int64(i))
+	}
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]interface{}{"name": "test", "namespace": "default"},
+		"spec":       map[string]interface{}{"replicas": int64(3), "items": items},
+		"status": map[string]interface{}{
+			"readyReplicas": int64(2),
+			"conditions": []interface{}{
+				map[string]interface{}{"type": "Available", "status": "True"},
+				map[string]interface{}{"type": "Progressing", "status": "True"},
+			},
+		},
+	}}
+}
+
+func TestProject(t *testing.T) {
+	tests := []struct {
+		name     string
+		field    Field
+		expected map[string]interface{}
+		err      bool
+	}{
+		{
+			name:     "jsonpath",
+			field:    Field{Name: "ready", JSONPath: "{.status.readyReplicas}"},
+			expected: map[string]interface{}{"ready": int64(2)},
+		},
+		{
+			name:     "jsonpath with several results",
+			field:    Field{Name: "types", JSONPath: "{.status.conditions[*].type}"},
+			expected: map[string]interface{}{"types": []interface{}{"Available", "Progressing"}},
+		},
+		{
+			name:     "jsonpath missing",
+			field:    Field{Name: "missing", JSONPath: "{.status.missing}"},
+			expected: map[string]interface{}{},
+		},
+		{
+			name:     "cel",
+			field:    Field{Name: "allReady", CEL: "object.status.readyReplicas == object.spec.replicas"},
+			expected: map[string]interface{}{"allReady": false},
+		},
+		{
+			name:     "cel missing key",
+			field:    Field{Name: "missing", CEL: "object.status.missing.value"},
+			expected: map[string]interface{}{},
+		},
+		{
+			name:  "cel type error",
+			field: Field{Name: "broken", CEL: "object.status.readyReplicas + 'a'"},
+			err:   true,
+		},
+		{
+			name:  "cel over the cost limit",
+			field: Field{Name: "expensive", CEL: "object.spec.items.map(x, object.spec.items.filter(y, y < x).size()).size()"},
+			err:   true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			projector, err := NewProjector(Config{Projections: []Projection{
+				{Group: "apps", Kind: "Deployment", Fields: []Field{test.field}},
+			}})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			projected, found, err := projector.Project(testObject())
+			if !found {
+				t.Fatal("expected a projection")
+			}
+			if test.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", projected)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(projected, test.expected) {
+				t.Errorf("got %#v, expected %#v", projected, test.expected)
+			}
+		})
+	}
+}
+
+func TestNewProjectorErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+	}{
+		{name: "no name", config: Config{Projections: []Projection{{Kind: "Pod", Fields: []Field{{JSONPath: "{.status}"}}}}}},
+		{name: "jsonpath and cel", config: Config{Projections: []Projection{{Kind: "Pod", Fields: []Field{{Name: "a", JSONPath: "{.status}", CEL: "1"}}}}}},
+		{name: "invalid cel", config: Config{Projections: []Projection{{Kind: "Pod", Fields: []Field{{Name: "a", CEL: "object."}}}}}},
+		{name: "duplicate", config: Config{Projections: []Projection{{Kind: "Pod"}, {Kind: "Pod"}}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := NewProjector(test.config); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
@@ -32,7 +33,9 @@ func AddonRBAC(kubeConfig *rest.Config) agent.PermissionConfigFunc {
 				{Verbs: []string{"get", "list", "watch", "create", "delete", "update", "patch"}, Resources: []string{"workstatuses"}, APIGroups: []string{"control.kubestellar.io"}},
 				{Verbs: []string{"patch", "update"}, Resources: []string{"workstatuses/status"}, APIGroups: []string{"control.kubestellar.io"}},
 				{Verbs: []string{"get", "list", "watch"}, Resources: []string{"managedclusteraddons"}, APIGroups: []string{"addon.open-cluster-management.io"}},
+				{Verbs: []string{"patch", "update"}, Resources: []string{"managedclusteraddons/status"}, APIGroups: []string{"addon.open-cluster-management.io"}},
 				{Verbs: []string{"get", "list", "watch"}, Resources: []string{"manifestworks"}, APIGroups: []string{"work.open-cluster-management.io"}},
+				{Verbs: []string{"create", "patch"}, Resources: []string{"events"}, APIGroups: []string{""}},
 			},
 		}
 
@@ -51,7 +54,7 @@ func AddonRBAC(kubeConfig *rest.Config) agent.PermissionConfigFunc {
 			},
 		}
 
-		_, err = kubeclient.RbacV1().Roles(cluster.Name).Get(context.TODO(), role.Name, metav1.GetOptions{})
+		existingRole, err := kubeclient.RbacV1().Roles(cluster.Name).Get(context.TODO(), role.Name, metav1.GetOptions{})
 		switch {
 		case errors.IsNotFound(err):
 			_, createErr := kubeclient.RbacV1().Roles(cluster.Name).Create(context.TODO(), role, metav1.CreateOptions{})
@@ -60,6 +63,13 @@ func AddonRBAC(kubeConfig *rest.Config) agent.PermissionConfigFunc {
 			}
 		case err != nil:
 			return err
+		case !equality.Semantic.DeepEqual(existingRole.Rules, role.Rules):
+			// roles created by previous versions are updated with the current rules
+			existingRole.Rules = role.Rules
+			_, updateErr := kubeclient.RbacV1().Roles(cluster.Name).Update(context.TODO(), existingRole, metav1.UpdateOptions{})
+			if updateErr != nil {
+				return updateErr
+			}
 		}
 
 		_, err = kubeclient.RbacV1().RoleBindings(cluster.Name).Get(context.TODO(), binding.Name, metav1.GetOptions{})
@@ -0,0 +1,229 @@
+package rbac
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+	workv1 "open-cluster-management.io/api/work/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/kubestellar/ocm-status-addon/pkg/tracking"
+)
+
+const (
+	TrackedKindsControllerName = "tracked-kinds-rbac"
+
+	// TrackedKindsFieldManager is the field manager used for the writes of the ManifestWorks
+	// carrying the ClusterRole for the tracked kinds
+	TrackedKindsFieldManager = "status-addon-rbac"
+
+	// TrackedKindsClusterRoleName is the name of the ClusterRole granting the agent read access
+	// to the kinds applied by the ManifestWorks of a cluster
+	TrackedKindsClusterRoleName = "status-agent-tracked-kinds"
+
+	// AggregateToAgentLabelKey is the label of the ClusterRoles aggregated into the ClusterRole
+	// of the agent on the managed clusters
+	AggregateToAgentLabelKey = "status.kubestellar.io/aggregate-to-status-agent"
+)
+
+// TrackedKindsReconciler maintains, in the namespace of each cluster with the addon, a ManifestWork
+// with a read-only ClusterRole for the kinds applied to the cluster by the ManifestWorks handled
+// by the agent and selected by its tracking rules. The ClusterRole is aggregated into the ClusterRole
+// of the agent, so that the agent can watch the objects it tracks without being granted access to
+// everything else, e.g. to the Secrets that are not tracked by default.
+type TrackedKindsReconciler struct {
+	client client.Client
+	// reader of the ManifestWork carrying the ClusterRole, as the cached ManifestWorks have no manifests
+	apiReader client.Reader
+	addonName string
+	// selector of the ManifestWorks whose objects are reported by the agent
+	selector tracking.ManifestWorkSelector
+	// tracking rules set by flags on the agents
+	trackingRules tracking.Rules
+}
+
+func NewTrackedKindsReconciler(c client.Client, apiReader client.Reader, addonName string, selector tracking.ManifestWorkSelector,
+	trackingRules tracking.Rules) *TrackedKindsReconciler {
+	return &TrackedKindsReconciler{client: c, apiReader: apiReader, addonName: addonName, selector: selector, trackingRules: trackingRules}
+}
+
+// ManifestWorkName returns the name of the ManifestWork carrying the ClusterRole for the tracked kinds
+func (r *TrackedKindsReconciler) ManifestWorkName() string {
+	return r.addonName + "-rbac"
+}
+
+// SetupWithManager sets up the watches of the controller. The ManifestWorks of a cluster are
+// mapped to the ManagedClusterAddOn of the addon in the cluster namespace.
+func (r *TrackedKindsReconciler) SetupWithManager(mgr manager.Manager) error {
+	return builder.ControllerManagedBy(mgr).
+		Named(TrackedKindsControllerName).
+		For(&addonapiv1alpha1.ManagedClusterAddOn{}, builder.WithPredicates(predicate.NewPredicateFuncs(func(obj client.Object) bool {
+			return obj.GetName() == r.addonName
+		}))).
+		Watches(&workv1.ManifestWork{}, handler.EnqueueRequestsFromMapFunc(func(_ context.Context, obj client.Object) []reconcile.Request {
+			mw := obj.(*workv1.ManifestWork)
+			if mw.Name != r.ManifestWorkName() && !r.isHandledByAgent(mw) {
+				return nil
+			}
+			return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: mw.Namespace, Name: r.addonName}}}
+		})).
+		Complete(r)
+}
+
+// Reconcile applies the ManifestWork with the ClusterRole for the kinds currently applied to a
+// cluster. The ManifestWork is owned by the ManagedClusterAddOn, so that it is garbage collected,
+// and the ClusterRole removed from the cluster, when the addon is disabled for the cluster.
+func (r *TrackedKindsReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx).WithValues("cluster", req.Namespace)
+
+	addon := &addonapiv1alpha1.ManagedClusterAddOn{}
+	if err := r.client.Get(ctx, req.NamespacedName, addon); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if addon.DeletionTimestamp != nil {
+		return ctrl.Result{}, nil
+	}
+
+	manifestWorks := &workv1.ManifestWorkList{}
+	if err := r.client.List(ctx, manifestWorks, client.InNamespace(req.Namespace)); err != nil {
+		return ctrl.Result{}, err
+	}
+	rules := r.rulesForManifestWorks(manifestWorks.Items)
+
+	current := &workv1.ManifestWork{}
+	err := r.apiReader.Get(ctx, client.ObjectKey{Namespace: req.Namespace, Name: r.ManifestWorkName()}, current)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return ctrl.Result{}, err
+	}
+	if err == nil && metav1.IsControlledBy(current, addon) {
+		if currentRules, ok := rulesInManifestWork(current); ok && equality.Semantic.DeepEqual(currentRules, rules) {
+			return ctrl.Result{}, nil
+		}
+	}
+
+	if err := r.applyManifestWork(ctx, addon, rules); err != nil {
+		return ctrl.Result{}, err
+	}
+	logger.V(2).Info("Applied tracked kinds clusterrole", "manifestwork", r.ManifestWorkName(), "rules", len(rules))
+	return ctrl.Result{}, nil
+}
+
+// applyManifestWork uses server-side apply to create or update the ManifestWork with the ClusterRole.
+func (r *TrackedKindsReconciler) applyManifestWork(ctx context.Context, addon *addonapiv1alpha1.ManagedClusterAddOn,
+	rules []rbacv1.PolicyRule) error {
+	raw, err := json.Marshal(newTrackedKindsClusterRole(rules))
+	if err != nil {
+		return err
+	}
+	spec := workv1.ManifestWorkSpec{
+		Workload: workv1.ManifestsTemplate{
+			Manifests: []workv1.Manifest{{RawExtension: runtime.RawExtension{Raw: raw}}},
+		},
+	}
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&spec)
+	if err != nil {
+		return err
+	}
+
+	u := &unstructured.Unstructured{}
+	u.SetGroupVersionKind(workv1.GroupVersion.WithKind("ManifestWork"))
+	u.SetNamespace(addon.Namespace)
+	u.SetName(r.ManifestWorkName())
+	u.SetOwnerReferences([]metav1.OwnerReference{
+		*metav1.NewControllerRef(addon, addonapiv1alpha1.GroupVersion.WithKind("ManagedClusterAddOn")),
+	})
+	u.Object["spec"] = content
+	return r.client.Patch(ctx, u, client.Apply, client.FieldOwner(TrackedKindsFieldManager), client.ForceOwnership)
+}
+
+// rulesForManifestWorks returns read-only rules for the resources applied by the ManifestWorks
+// handled by the agent, with one rule per API group.
+func (r *TrackedKindsReconciler) rulesForManifestWorks(manifestWorks []workv1.ManifestWork) []rbacv1.PolicyRule {
+	resourcesByGroup := map[string]sets.Set[string]{}
+	for i := range manifestWorks {
+		if !r.isHandledByAgent(&manifestWorks[i]) {
+			continue
+		}
+		for _, manifest := range manifestWorks[i].Status.ResourceStatus.Manifests {
+			meta := manifest.ResourceMeta
+			if meta.Resource == "" {
+				continue
+			}
+			// the kinds of which no object is tracked by the agent are not readable
+			if !r.trackingRules.TracksGroupKind(schema.GroupKind{Group: meta.Group, Kind: meta.Kind}) {
+				continue
+			}
+			if _, ok := resourcesByGroup[meta.Group]; !ok {
+				resourcesByGroup[meta.Group] = sets.New[string]()
+			}
+			resourcesByGroup[meta.Group].Insert(meta.Resource)
+		}
+	}
+
+	groups := make([]string, 0, len(resourcesByGroup))
+	for group := range resourcesByGroup {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+
+	rules := []rbacv1.PolicyRule{}
+	for _, group := range groups {
+		rules = append(rules, rbacv1.PolicyRule{
+			APIGroups: []string{group},
+			Resources: sets.List(resourcesByGroup[group]),
+			Verbs:     []string{"get", "list", "watch"},
+		})
+	}
+	return rules
+}
+
+// rulesInManifestWork returns the rules of the ClusterRole in a ManifestWork, and false if
+// the ManifestWork does not carry the expected ClusterRole.
+func rulesInManifestWork(mw *workv1.ManifestWork) ([]rbacv1.PolicyRule, bool) {
+	if len(mw.Spec.Workload.Manifests) != 1 {
+		return nil, false
+	}
+	clusterRole := &rbacv1.ClusterRole{}
+	if err := json.Unmarshal(mw.Spec.Workload.Manifests[0].Raw, clusterRole); err != nil {
+		return nil, false
+	}
+	if !equality.Semantic.DeepEqual(clusterRole, newTrackedKindsClusterRole(clusterRole.Rules)) {
+		return nil, false
+	}
+	return clusterRole.Rules, true
+}
+
+func newTrackedKindsClusterRole(rules []rbacv1.PolicyRule) *rbacv1.ClusterRole {
+	return &rbacv1.ClusterRole{
+		TypeMeta: metav1.TypeMeta{APIVersion: rbacv1.SchemeGroupVersion.String(), Kind: "ClusterRole"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   TrackedKindsClusterRoleName,
+			Labels: map[string]string{AggregateToAgentLabelKey: "true"},
+		},
+		Rules: rules,
+	}
+}
+
+// isHandledByAgent returns whether the objects of a ManifestWork are tracked by the agent,
+// which is never the case for the ManifestWork carrying the ClusterRole
+func (r *TrackedKindsReconciler) isHandledByAgent(mw *workv1.ManifestWork) bool {
+	return mw.Name != r.ManifestWorkName() && r.selector.Matches(mw)
+}
@@ -0,0 +1,376 @@
+package redaction
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/util/jsonpath"
+	"sigs.k8s.io/yaml"
+)
+
+// DefaultKeys are the built-in patterns of the keys whose values are redacted in all statuses
+const DefaultKeys = "*password*,*token*,*secret*"
+
+// HashPrefix starts the values replaced with a salted hash
+const HashPrefix = "redacted-sha256:"
+
+// Action is what is done to a redacted value
+type Action string
+
+const (
+	// ActionRemove removes the value, together with its key or its position in a list
+	ActionRemove Action = "remove"
+	// ActionHash replaces the value with a salted hash of it, so that its changes remain visible
+	ActionHash Action = "hash"
+)
+
+// Rule lists the values redacted in the status of the objects of a kind. The JSONPaths are evaluated
+// on the object with the reported status, e.g. "{.status.endpoints[*].address}", and only support
+// fields, wildcards and array indexes or slices.
+type Rule struct {
+	Group     string   `json:"group"`
+	Kind      string   `json:"kind"`
+	JSONPaths []string `json:"jsonPaths"`
+	// Action is remove when not set
+	Action Action `json:"action,omitempty"`
+}
+
+// Config is the content of a status redaction file.
+type Config struct {
+	// Keys are glob patterns of keys, matched regardless of case, whose values are redacted
+	// in the statuses of all kinds, in addition to the built-in patterns
+	Keys []string `json:"keys,omitempty"`
+	// KeyAction is the action for the values of the matching keys, remove when not set
+	KeyAction Action `json:"keyAction,omitempty"`
+	Rules     []Rule `json:"rules,omitempty"`
+}
+
+// Redactor removes or hashes the sensitive values of reported statuses.
+type Redactor struct {
+	keys      []string
+	keyAction Action
+	rules     map[schema.GroupKind][]compiledPath
+	salt      []byte
+	// set when values to hash are removed for lack of a salt
+	hashesRemoved bool
+}
+
+type compiledPath struct {
+	nodes  []jsonpath.Node
+	action Action
+}
+
+// ReadFile reads the redaction rules in a YAML file and returns a redactor for them and the given
+// built-in key patterns, together with the content of the file. A file that does not exist is read
+// as no rules.
+func ReadFile(file string, defaultKeys []string, salt []byte) (*Redactor, []byte, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			redactor, err := NewRedactor(defaultKeys, Config{}, salt)
+			return redactor, nil, err
+		}
+		return nil, nil, err
+	}
+	config := Config{}
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return nil, nil, fmt.Errorf("invalid status redaction file %s: %w", file, err)
+	}
+	redactor, err := NewRedactor(defaultKeys, config, salt)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid status redaction file %s: %w", file, err)
+	}
+	return redactor, data, nil
+}
+
+// ParseKeys parses comma separated key patterns.
+func ParseKeys(keys string) ([]string, error) {
+	patterns := []string{}
+	for _, key := range strings.Split(keys, ",") {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+		if _, err := path.Match(key, ""); err != nil {
+			return nil, fmt.Errorf("invalid key pattern %q: %w", key, err)
+		}
+		patterns = append(patterns, key)
+	}
+	return patterns, nil
+}
+
+// NewRedactor parses the JSONPaths of the rules. The salt is prepended to the values before hashing them.
+// Without a salt, the values to hash are removed instead, as the hashes of values that are easy to guess
+// could be reversed.
+func NewRedactor(defaultKeys []string, config Config, salt []byte) (*Redactor, error) {
+	redactor := &Redactor{rules: map[schema.GroupKind][]compiledPath{}, salt: salt}
+	keyAction, err := redactor.parseAction(config.KeyAction)
+	if err != nil {
+		return nil, err
+	}
+	redactor.keyAction = keyAction
+	for _, key := range append(append([]string{}, defaultKeys...), config.Keys...) {
+		if _, err := path.Match(key, ""); err != nil {
+			return nil, fmt.Errorf("invalid key pattern %q: %w", key, err)
+		}
+		redactor.keys = append(redactor.keys, strings.ToLower(key))
+	}
+	for _, rule := range config.Rules {
+		gk := schema.GroupKind{Group: rule.Group, Kind: rule.Kind}
+		action, err := redactor.parseAction(rule.Action)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rule for %s: %w", gk, err)
+		}
+		for _, jsonPath := range rule.JSONPaths {
+			nodes, err := compilePath(jsonPath)
+			if err != nil {
+				return nil, fmt.Errorf("invalid jsonPath %q for %s: %w", jsonPath, gk, err)
+			}
+			redactor.rules[gk] = append(redactor.rules[gk], compiledPath{nodes: nodes, action: action})
+		}
+	}
+	return redactor, nil
+}
+
+// HashesRemoved returns true if values configured to be hashed are removed because there is no salt.
+func (r *Redactor) HashesRemoved() bool {
+	return r.hashesRemoved
+}
+
+func (r *Redactor) parseAction(action Action) (Action, error) {
+	switch action {
+	case "", ActionRemove:
+		return ActionRemove, nil
+	case ActionHash:
+		if len(r.salt) == 0 {
+			r.hashesRemoved = true
+			return ActionRemove, nil
+		}
+		return action, nil
+	default:
+		return "", fmt.Errorf("unknown action %q, expected %s or %s", action, ActionRemove, ActionHash)
+	}
+}
+
+// compilePath parses a JSONPath made of a single expression with fields, wildcards and array indexes or slices
+func compilePath(text string) ([]jsonpath.Node, error) {
+	parser, err := jsonpath.Parse("redaction", text)
+	if err != nil {
+		return nil, err
+	}
+	if len(parser.Root.Nodes) != 1 || parser.Root.Nodes[0].Type() != jsonpath.NodeList {
+		return nil, fmt.Errorf("expected a single {} expression")
+	}
+	nodes := []jsonpath.Node{}
+	for _, node := range parser.Root.Nodes[0].(*jsonpath.ListNode).Nodes {
+		switch node.Type() {
+		case jsonpath.NodeField:
+			// a lone dot selects the current value
+			if node.(*jsonpath.FieldNode).Value != "" {
+				nodes = append(nodes, node)
+			}
+		case jsonpath.NodeArray, jsonpath.NodeWildcard:
+			nodes = append(nodes, node)
+		default:
+			return nil, fmt.Errorf("unsupported %s in expression", node.Type())
+		}
+	}
+	if len(nodes) == 0 {
+		return nil, fmt.Errorf("the expression must select a field of the object")
+	}
+	return nodes, nil
+}
+
+// Redact returns the status with the values selected by the rules of the kind and by the key
+// patterns removed or hashed, and the number of redacted values. The status is returned unchanged
+// when nothing is redacted.
+func (r *Redactor) Redact(gk schema.GroupKind, status []byte) ([]byte, int, error) {
+	paths := r.rules[gk]
+	if len(status) == 0 || (len(paths) == 0 && len(r.keys) == 0) {
+		return status, 0, nil
+	}
+	var value any
+	if err := json.Unmarshal(status, &value); err != nil {
+		return nil, 0, err
+	}
+	// the JSONPaths are evaluated on an object holding the status
+	object := map[string]any{"status": value}
+	count := 0
+	for _, p := range paths {
+		// the paths select a field of the object, which is never replaced or removed itself
+		count += r.redactPath(object, p.nodes, p.action, func(any) {}, func() {})
+	}
+	count += r.redactKeys(object["status"])
+	if count == 0 {
+		return status, 0, nil
+	}
+	redacted, ok := object["status"]
+	if !ok {
+		redacted = map[string]any{}
+	}
+	data, err := json.Marshal(redacted)
+	return data, count, err
+}
+
+// redactPath applies an action to the values selected by the nodes in a value, where set replaces
+// and remove removes the value in its parent. Returns the number of redacted values.
+func (r *Redactor) redactPath(value any, nodes []jsonpath.Node, action Action, set func(any), remove func()) int {
+	if len(nodes) == 0 {
+		if action == ActionRemove {
+			remove()
+		} else {
+			set(r.hash(value))
+		}
+		return 1
+	}
+	count := 0
+	switch node := nodes[0].(type) {
+	case *jsonpath.FieldNode:
+		m, ok := value.(map[string]any)
+		if !ok {
+			return 0
+		}
+		child, ok := m[node.Value]
+		if !ok {
+			return 0
+		}
+		count += r.redactPath(child, nodes[1:], action, func(v any) { m[node.Value] = v }, func() { delete(m, node.Value) })
+	case *jsonpath.WildcardNode:
+		switch v := value.(type) {
+		case map[string]any:
+			for _, key := range sortedKeys(v) {
+				count += r.redactPath(v[key], nodes[1:], action, func(nv any) { v[key] = nv }, func() { delete(v, key) })
+			}
+		case []any:
+			count += r.redactElements(v, allIndexes(len(v)), nodes[1:], action, set)
+		}
+	case *jsonpath.ArrayNode:
+		if s, ok := value.([]any); ok {
+			count += r.redactElements(s, arrayIndexes(node.Params, len(s)), nodes[1:], action, set)
+		}
+	}
+	return count
+}
+
+// redactElements redacts the elements at the given indexes of a list, and replaces the list
+// in its parent when elements are removed
+func (r *Redactor) redactElements(s []any, indexes []int, nodes []jsonpath.Node, action Action, set func(any)) int {
+	count := 0
+	removed := map[int]bool{}
+	for _, i := range indexes {
+		count += r.redactPath(s[i], nodes, action, func(v any) { s[i] = v }, func() { removed[i] = true })
+	}
+	if len(removed) > 0 {
+		kept := []any{}
+		for i := range s {
+			if !removed[i] {
+				kept = append(kept, s[i])
+			}
+		}
+		set(kept)
+	}
+	return count
+}
+
+// arrayIndexes returns the indexes selected by the params of an array node, as evaluated by jsonpath
+func arrayIndexes(params [3]jsonpath.ParamsEntry, length int) []int {
+	start, end, step := 0, length, 1
+	if params[0].Known {
+		start = params[0].Value
+		if start < 0 {
+			start += length
+		}
+	}
+	if params[1].Known {
+		end = params[1].Value
+		if params[1].Derived {
+			end = start + 1
+		} else if end < 0 {
+			end += length
+		}
+	}
+	if params[2].Known && params[2].Value > 0 {
+		step = params[2].Value
+	}
+	start, end = max(start, 0), min(end, length)
+	indexes := []int{}
+	for i := start; i < end; i += step {
+		indexes = append(indexes, i)
+	}
+	return indexes
+}
+
+func allIndexes(length int) []int {
+	indexes := make([]int, length)
+	for i := range indexes {
+		indexes[i] = i
+	}
+	return indexes
+}
+
+// redactKeys applies the key action to the values of the keys matching the key patterns,
+// at any depth. Values already hashed by a rule are left as they are.
+func (r *Redactor) redactKeys(value any) int {
+	count := 0
+	switch v := value.(type) {
+	case map[string]any:
+		for _, key := range sortedKeys(v) {
+			if r.matchesKey(key) && !isHashed(v[key]) {
+				if r.keyAction == ActionRemove {
+					delete(v, key)
+				} else {
+					v[key] = r.hash(v[key])
+				}
+				count++
+				continue
+			}
+			count += r.redactKeys(v[key])
+		}
+	case []any:
+		for _, element := range v {
+			count += r.redactKeys(element)
+		}
+	}
+	return count
+}
+
+func (r *Redactor) matchesKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, pattern := range r.keys {
+		if matched, _ := path.Match(pattern, key); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// hash returns the salted hash of the JSON encoding of a value
+func (r *Redactor) hash(value any) string {
+	data, _ := json.Marshal(value)
+	h := sha256.New()
+	h.Write(r.salt)
+	h.Write(data)
+	return HashPrefix + hex.EncodeToString(h.Sum(nil))
+}
+
+func isHashed(value any) bool {
+	s, ok := value.(string)
+	return ok && strings.HasPrefix(s, HashPrefix)
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,244 @@
+package redaction
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const testStatus = `{
+	"replicas": 3,
+	"endpoints": [{"address": "a", "port": 1}, {"address": "b", "port": 2}, {"address": "c", "port": 3}],
+	"Password": "p",
+	"nested": {"list": [{"apiToken": "t", "name": "x"}, {"name": "y"}]}
+}`
+
+func TestRedact(t *testing.T) {
+	database := schema.GroupKind{Group: "example.io", Kind: "Database"}
+	salt := []byte("salt")
+	h := func(value any) string {
+		return (&Redactor{salt: salt}).hash(value)
+	}
+	tests := []struct {
+		name     string
+		keys     []string
+		config   Config
+		salt     []byte
+		gk       schema.GroupKind
+		expected string
+		count    int
+		removed  bool
+	}{
+		{
+			name:     "no rules",
+			expected: testStatus,
+		},
+		{
+			name:     "fields of all elements",
+			config:   Config{Rules: []Rule{{Group: "example.io", Kind: "Database", JSONPaths: []string{"{.status.endpoints[*].address}"}}}},
+			expected: `{"replicas":3,"endpoints":[{"port":1},{"port":2},{"port":3}],"Password":"p","nested":{"list":[{"apiToken":"t","name":"x"},{"name":"y"}]}}`,
+			count:    3,
+		},
+		{
+			name: "hashed fields of all elements",
+			config: Config{Rules: []Rule{
+				{Group: "example.io", Kind: "Database", JSONPaths: []string{"{.status.endpoints[*].address}"}, Action: ActionHash},
+			}},
+			expected: `{"replicas":3,"endpoints":[{"address":"` + h("a") + `","port":1},{"address":"` + h("b") + `","port":2},` +
+				`{"address":"` + h("c") + `","port":3}],"Password":"p","nested":{"list":[{"apiToken":"t","name":"x"},{"name":"y"}]}}`,
+			count: 3,
+		},
+		{
+			name:     "element",
+			config:   Config{Rules: []Rule{{Group: "example.io", Kind: "Database", JSONPaths: []string{"{.status.endpoints[1]}"}}}},
+			expected: `{"replicas":3,"endpoints":[{"address":"a","port":1},{"address":"c","port":3}],"Password":"p","nested":{"list":[{"apiToken":"t","name":"x"},{"name":"y"}]}}`,
+			count:    1,
+		},
+		{
+			name:     "negative index",
+			config:   Config{Rules: []Rule{{Group: "example.io", Kind: "Database", JSONPaths: []string{"{.status.endpoints[-1]}"}}}},
+			expected: `{"replicas":3,"endpoints":[{"address":"a","port":1},{"address":"b","port":2}],"Password":"p","nested":{"list":[{"apiToken":"t","name":"x"},{"name":"y"}]}}`,
+			count:    1,
+		},
+		{
+			name:     "index out of range",
+			config:   Config{Rules: []Rule{{Group: "example.io", Kind: "Database", JSONPaths: []string{"{.status.endpoints[5]}"}}}},
+			expected: testStatus,
+		},
+		{
+			name: "slice",
+			config: Config{Rules: []Rule{
+				{Group: "example.io", Kind: "Database", JSONPaths: []string{"{.status.endpoints[0:2].address}"}, Action: ActionHash},
+			}},
+			expected: `{"replicas":3,"endpoints":[{"address":"` + h("a") + `","port":1},{"address":"` + h("b") + `","port":2},` +
+				`{"address":"c","port":3}],"Password":"p","nested":{"list":[{"apiToken":"t","name":"x"},{"name":"y"}]}}`,
+			count: 2,
+		},
+		{
+			name:     "slice with a step",
+			config:   Config{Rules: []Rule{{Group: "example.io", Kind: "Database", JSONPaths: []string{"{.status.endpoints[0:3:2]}"}}}},
+			expected: `{"replicas":3,"endpoints":[{"address":"b","port":2}],"Password":"p","nested":{"list":[{"apiToken":"t","name":"x"},{"name":"y"}]}}`,
+			count:    2,
+		},
+		{
+			name:     "negative slice",
+			config:   Config{Rules: []Rule{{Group: "example.io", Kind: "Database", JSONPaths: []string{"{.status.endpoints[-2:]}"}}}},
+			expected: `{"replicas":3,"endpoints":[{"address":"a","port":1}],"Password":"p","nested":{"list":[{"apiToken":"t","name":"x"},{"name":"y"}]}}`,
+			count:    2,
+		},
+		{
+			name:     "nested removal in lists",
+			config:   Config{Rules: []Rule{{Group: "example.io", Kind: "Database", JSONPaths: []string{"{.status.nested.list[*].name}"}}}},
+			expected: `{"replicas":3,"endpoints":[{"address":"a","port":1},{"address":"b","port":2},{"address":"c","port":3}],"Password":"p","nested":{"list":[{"apiToken":"t"},{}]}}`,
+			count:    2,
+		},
+		{
+			name:     "wildcard on a map",
+			config:   Config{Rules: []Rule{{Group: "example.io", Kind: "Database", JSONPaths: []string{"{.status.nested.*}"}}}},
+			expected: `{"replicas":3,"endpoints":[{"address":"a","port":1},{"address":"b","port":2},{"address":"c","port":3}],"Password":"p","nested":{}}`,
+			count:    1,
+		},
+		{
+			name:     "whole status",
+			config:   Config{Rules: []Rule{{Group: "example.io", Kind: "Database", JSONPaths: []string{"{.status}"}}}},
+			expected: `{}`,
+			count:    1,
+		},
+		{
+			name:     "missing path",
+			config:   Config{Rules: []Rule{{Group: "example.io", Kind: "Database", JSONPaths: []string{"{.status.missing[*].address}"}}}},
+			expected: testStatus,
+		},
+		{
+			name:     "rule of another kind",
+			config:   Config{Rules: []Rule{{Group: "example.io", Kind: "Cache", JSONPaths: []string{"{.status.replicas}"}}}},
+			expected: testStatus,
+		},
+		{
+			name:     "key patterns regardless of case",
+			keys:     []string{"*token*"},
+			config:   Config{Keys: []string{"PASS*"}},
+			expected: `{"replicas":3,"endpoints":[{"address":"a","port":1},{"address":"b","port":2},{"address":"c","port":3}],"nested":{"list":[{"name":"x"},{"name":"y"}]}}`,
+			count:    2,
+		},
+		{
+			name:   "hashed keys",
+			keys:   []string{"*token*", "password"},
+			config: Config{KeyAction: ActionHash},
+			expected: `{"replicas":3,"endpoints":[{"address":"a","port":1},{"address":"b","port":2},{"address":"c","port":3}],"Password":"` + h("p") +
+				`","nested":{"list":[{"apiToken":"` + h("t") + `","name":"x"},{"name":"y"}]}}`,
+			count: 2,
+		},
+		{
+			name:     "key pattern matching the whole key",
+			keys:     []string{"token"},
+			expected: testStatus,
+		},
+		{
+			name:     "key of a removed value",
+			keys:     []string{"*token*"},
+			config:   Config{Rules: []Rule{{Group: "example.io", Kind: "Database", JSONPaths: []string{"{.status.nested}"}}}},
+			expected: `{"replicas":3,"endpoints":[{"address":"a","port":1},{"address":"b","port":2},{"address":"c","port":3}],"Password":"p"}`,
+			count:    1,
+		},
+		{
+			name: "key of a hashed value",
+			keys: []string{"*token*"},
+			config: Config{Rules: []Rule{
+				{Group: "example.io", Kind: "Database", JSONPaths: []string{"{.status.nested.list[0].apiToken}"}, Action: ActionHash},
+			}},
+			expected: `{"replicas":3,"endpoints":[{"address":"a","port":1},{"address":"b","port":2},{"address":"c","port":3}],"Password":"p",` +
+				`"nested":{"list":[{"apiToken":"` + h("t") + `","name":"x"},{"name":"y"}]}}`,
+			count: 1,
+		},
+		{
+			name: "hash without a salt",
+			salt: []byte{},
+			keys: []string{"password"},
+			config: Config{KeyAction: ActionHash, Rules: []Rule{
+				{Group: "example.io", Kind: "Database", JSONPaths: []string{"{.status.endpoints[*].address}"}, Action: ActionHash},
+			}},
+			expected: `{"replicas":3,"endpoints":[{"port":1},{"port":2},{"port":3}],"nested":{"list":[{"apiToken":"t","name":"x"},{"name":"y"}]}}`,
+			count:    4,
+			removed:  true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			redactorSalt := salt
+			if test.salt != nil {
+				redactorSalt = test.salt
+			}
+			redactor, err := NewRedactor(test.keys, test.config, redactorSalt)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if redactor.HashesRemoved() != test.removed {
+				t.Errorf("got HashesRemoved %t, expected %t", redactor.HashesRemoved(), test.removed)
+			}
+			gk := database
+			if !test.gk.Empty() {
+				gk = test.gk
+			}
+			redacted, count, err := redactor.Redact(gk, []byte(testStatus))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if count != test.count {
+				t.Errorf("got %d redacted values, expected %d", count, test.count)
+			}
+			if count == 0 && string(redacted) != testStatus {
+				t.Errorf("got status %s, expected the status unchanged", redacted)
+			}
+			var got, expected any
+			if err := json.Unmarshal(redacted, &got); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal([]byte(test.expected), &expected); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, expected) {
+				t.Errorf("got status %s, expected %s", redacted, test.expected)
+			}
+		})
+	}
+}
+
+func TestHash(t *testing.T) {
+	redactor := &Redactor{salt: []byte("salt")}
+	if redactor.hash("a") != redactor.hash("a") {
+		t.Error("expected the hashes of the same value to be equal")
+	}
+	if redactor.hash("a") == redactor.hash("b") {
+		t.Error("expected the hashes of different values to differ")
+	}
+	if redactor.hash("a") == (&Redactor{salt: []byte("other")}).hash("a") {
+		t.Error("expected the hashes with different salts to differ")
+	}
+}
+
+func TestNewRedactorErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		keys   []string
+		config Config
+	}{
+		{name: "invalid default key", keys: []string{"[a"}},
+		{name: "invalid key", config: Config{Keys: []string{"[a"}}},
+		{name: "unknown key action", config: Config{KeyAction: "mask"}},
+		{name: "unknown action", config: Config{Rules: []Rule{{Kind: "Pod", JSONPaths: []string{"{.status.a}"}, Action: "mask"}}}},
+		{name: "invalid jsonpath", config: Config{Rules: []Rule{{Kind: "Pod", JSONPaths: []string{"{.status.a"}}}}},
+		{name: "several expressions", config: Config{Rules: []Rule{{Kind: "Pod", JSONPaths: []string{"{.status.a}{.status.b}"}}}}},
+		{name: "filter", config: Config{Rules: []Rule{{Kind: "Pod", JSONPaths: []string{"{.status.a[?(@.b=='c')]}"}}}}},
+		{name: "no field", config: Config{Rules: []Rule{{Kind: "Pod", JSONPaths: []string{"{.}"}}}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := NewRedactor(test.keys, test.config, []byte("salt")); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package tracking
+
+import (
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// ManifestWorkSelector selects the ManifestWorks whose objects are reported with WorkStatuses.
+// A ManifestWork is selected if it has a label with a key starting with one of the prefixes, or if it
+// matches the label selector or the annotation selector. A ManifestWorkSelector with no prefixes and
+// no selectors selects all ManifestWorks.
+type ManifestWorkSelector struct {
+	LabelKeyPrefixes []string
+	// nil when not set
+	Labels      labels.Selector
+	Annotations labels.Selector
+}
+
+// ParseManifestWorkSelector parses a comma separated list of label key prefixes, a label selector and
+// a selector applied to the annotations, with the syntax of label selectors (e.g. "app=foo,tier in (a,b)").
+func ParseManifestWorkSelector(labelKeyPrefixes, labelSelector, annotationSelector string) (ManifestWorkSelector, error) {
+	selector := ManifestWorkSelector{}
+	for _, prefix := range strings.Split(labelKeyPrefixes, ",") {
+		if prefix = strings.TrimSpace(prefix); prefix != "" {
+			selector.LabelKeyPrefixes = append(selector.LabelKeyPrefixes, prefix)
+		}
+	}
+	var err error
+	if strings.TrimSpace(labelSelector) != "" {
+		if selector.Labels, err = labels.Parse(labelSelector); err != nil {
+			return ManifestWorkSelector{}, fmt.Errorf("invalid manifestwork label selector: %w", err)
+		}
+	}
+	if strings.TrimSpace(annotationSelector) != "" {
+		if selector.Annotations, err = labels.Parse(annotationSelector); err != nil {
+			return ManifestWorkSelector{}, fmt.Errorf("invalid manifestwork annotation selector: %w", err)
+		}
+	}
+	return selector, nil
+}
+
+// Matches returns whether a ManifestWork is selected
+func (s ManifestWorkSelector) Matches(mw metav1.Object) bool {
+	if len(s.LabelKeyPrefixes) == 0 && s.Labels == nil && s.Annotations == nil {
+		return true
+	}
+	for key := range mw.GetLabels() {
+		for _, prefix := range s.LabelKeyPrefixes {
+			if strings.HasPrefix(key, prefix) {
+				return true
+			}
+		}
+	}
+	if s.Labels != nil && s.Labels.Matches(labels.Set(mw.GetLabels())) {
+		return true
+	}
+	return s.Annotations != nil && s.Annotations.Matches(labels.Set(mw.GetAnnotations()))
+}
@@ -0,0 +1,182 @@
+package tracking
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/yaml"
+)
+
+// DefaultExclude lists the kinds excluded by default, as generally all resources
+// not creating a status should be excluded
+const DefaultExclude = "rbac.authorization.k8s.io/ClusterRoleBinding,rbac.authorization.k8s.io/ClusterRole," +
+	"rbac.authorization.k8s.io/Role,rbac.authorization.k8s.io/RoleBinding,/Secret,/ConfigMap,/ServiceAccount"
+
+// Rule selects objects by API group, kind and namespace. Group and Kind are patterns
+// as accepted by path.Match (e.g. "*.crossplane.io"), the core group is the empty string.
+// Namespaces lists patterns for the namespace of the objects. A rule with no namespaces
+// selects objects in all namespaces as well as cluster-scoped objects, otherwise it only
+// selects namespaced objects.
+type Rule struct {
+	Group      string   `json:"group"`
+	Kind       string   `json:"kind"`
+	Namespaces []string `json:"namespaces,omitempty"`
+}
+
+// Rules determine the objects tracked by the agent. An object is tracked if it is
+// selected by an include rule, or there are no include rules, and it is not selected
+// by an exclude rule.
+type Rules struct {
+	Include []Rule `json:"include,omitempty"`
+	Exclude []Rule `json:"exclude,omitempty"`
+}
+
+// ParseRules parses a comma separated list of rules in the form group/kind[@namespace[;namespace...]],
+// for example "/Event,*.crossplane.io/*,/PersistentVolumeClaim@team-a;team-b".
+func ParseRules(value string) ([]Rule, error) {
+	rules := []Rule{}
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		groupKind, namespaces, hasNamespaces := strings.Cut(item, "@")
+		group, kind, ok := strings.Cut(groupKind, "/")
+		if !ok || kind == "" {
+			return nil, fmt.Errorf("invalid rule %q: expected group/kind[@namespace[;namespace...]]", item)
+		}
+		rule := Rule{Group: group, Kind: kind}
+		if hasNamespaces {
+			rule.Namespaces = strings.Split(namespaces, ";")
+		}
+		if err := rule.validate(); err != nil {
+			return nil, fmt.Errorf("invalid rule %q: %w", item, err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// ReadRulesFile reads rules from a YAML file with "include" and "exclude" lists of rules.
+// A file that does not exist is read as no rules, so that the file can be optional.
+func ReadRulesFile(file string) (Rules, []byte, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return Rules{}, nil, nil
+		}
+		return Rules{}, nil, err
+	}
+	rules := Rules{}
+	if err := yaml.UnmarshalStrict(data, &rules); err != nil {
+		return Rules{}, nil, fmt.Errorf("invalid rules file %s: %w", file, err)
+	}
+	for _, rule := range append(rules.Include, rules.Exclude...) {
+		if err := rule.validate(); err != nil {
+			return Rules{}, nil, fmt.Errorf("invalid rule %s/%s in file %s: %w", rule.Group, rule.Kind, file, err)
+		}
+	}
+	return rules, data, nil
+}
+
+// Merge returns the rules with the rules of other appended.
+func (r Rules) Merge(other Rules) Rules {
+	return Rules{
+		Include: append(append([]Rule{}, r.Include...), other.Include...),
+		Exclude: append(append([]Rule{}, r.Exclude...), other.Exclude...),
+	}
+}
+
+// TracksGroupKind returns false if no object of the given kind can be tracked, that is
+// the kind is not selected by any include rule or it is excluded in all namespaces.
+func (r Rules) TracksGroupKind(gk schema.GroupKind) bool {
+	included := len(r.Include) == 0
+	for _, rule := range r.Include {
+		if rule.matchesGroupKind(gk) {
+			included = true
+			break
+		}
+	}
+	if !included {
+		return false
+	}
+	for _, rule := range r.Exclude {
+		if len(rule.Namespaces) == 0 && rule.matchesGroupKind(gk) {
+			return false
+		}
+	}
+	return true
+}
+
+// Tracks returns true if the object with the given kind and namespace is tracked.
+// The namespace is empty for cluster-scoped objects.
+func (r Rules) Tracks(gk schema.GroupKind, namespace string) bool {
+	included := len(r.Include) == 0
+	for _, rule := range r.Include {
+		if rule.matches(gk, namespace) {
+			included = true
+			break
+		}
+	}
+	if !included {
+		return false
+	}
+	for _, rule := range r.Exclude {
+		if rule.matches(gk, namespace) {
+			return false
+		}
+	}
+	return true
+}
+
+// MatchesGroupKind returns true if any of the rules selects the given kind,
+// regardless of the namespaces of the rules.
+func MatchesGroupKind(rules []Rule, gk schema.GroupKind) bool {
+	for _, rule := range rules {
+		if rule.matchesGroupKind(gk) {
+			return true
+		}
+	}
+	return false
+}
+
+func (rule Rule) matches(gk schema.GroupKind, namespace string) bool {
+	if !rule.matchesGroupKind(gk) {
+		return false
+	}
+	if len(rule.Namespaces) == 0 {
+		return true
+	}
+	if namespace == "" {
+		return false
+	}
+	for _, pattern := range rule.Namespaces {
+		if ok, _ := path.Match(pattern, namespace); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (rule Rule) matchesGroupKind(gk schema.GroupKind) bool {
+	groupMatch, _ := path.Match(rule.Group, gk.Group)
+	kindMatch, _ := path.Match(rule.Kind, gk.Kind)
+	return groupMatch && kindMatch
+}
+
+// patterns are validated when parsed, so that match errors can be ignored
+func (rule Rule) validate() error {
+	if rule.Kind == "" {
+		return fmt.Errorf("kind must not be empty")
+	}
+	for _, pattern := range append([]string{rule.Group, rule.Kind}, rule.Namespaces...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package tracking
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestParseRules(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		expected []Rule
+		err      bool
+	}{
+		{name: "empty", value: "", expected: []Rule{}},
+		{name: "blank items", value: " , ,", expected: []Rule{}},
+		{name: "core group", value: "/Event", expected: []Rule{{Group: "", Kind: "Event"}}},
+		{
+			name:  "patterns and spaces",
+			value: " *.crossplane.io/* , apps/Deployment",
+			expected: []Rule{
+				{Group: "*.crossplane.io", Kind: "*"},
+				{Group: "apps", Kind: "Deployment"},
+			},
+		},
+		{
+			name:     "namespaces",
+			value:    "/PersistentVolumeClaim@team-a;team-*",
+			expected: []Rule{{Group: "", Kind: "PersistentVolumeClaim", Namespaces: []string{"team-a", "team-*"}}},
+		},
+		{name: "default exclude", value: DefaultExclude, expected: []Rule{
+			{Group: "rbac.authorization.k8s.io", Kind: "ClusterRoleBinding"},
+			{Group: "rbac.authorization.k8s.io", Kind: "ClusterRole"},
+			{Group: "rbac.authorization.k8s.io", Kind: "Role"},
+			{Group: "rbac.authorization.k8s.io", Kind: "RoleBinding"},
+			{Group: "", Kind: "Secret"},
+			{Group: "", Kind: "ConfigMap"},
+			{Group: "", Kind: "ServiceAccount"},
+		}},
+		{name: "no slash", value: "Event", err: true},
+		{name: "no kind", value: "apps/", err: true},
+		{name: "no kind with namespaces", value: "apps/@default", err: true},
+		{name: "invalid group pattern", value: "[/Pod", err: true},
+		{name: "invalid kind pattern", value: "/Pod[", err: true},
+		{name: "invalid namespace pattern", value: "/Pod@team-[", err: true},
+		{name: "one invalid rule", value: "/Pod,Event", err: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rules, err := ParseRules(test.value)
+			if test.err {
+				if err == nil {
+					t.Fatalf("expected an error, got rules %v", rules)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(rules, test.expected) {
+				t.Errorf("got rules %v, expected %v", rules, test.expected)
+			}
+		})
+	}
+}
+
+func mustParseRules(t *testing.T, include, exclude string) Rules {
+	t.Helper()
+	includeRules, err := ParseRules(include)
+	if err != nil {
+		t.Fatal(err)
+	}
+	excludeRules, err := ParseRules(exclude)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Rules{Include: includeRules, Exclude: excludeRules}
+}
+
+func TestRulesTracks(t *testing.T) {
+	pod := schema.GroupKind{Kind: "Pod"}
+	secret := schema.GroupKind{Kind: "Secret"}
+	namespace := schema.GroupKind{Kind: "Namespace"}
+	composition := schema.GroupKind{Group: "apiextensions.crossplane.io", Kind: "Composition"}
+	tests := []struct {
+		name             string
+		include, exclude string
+		gk               schema.GroupKind
+		namespace        string
+		tracks           bool
+		tracksGroupKind  bool
+	}{
+		{name: "no rules", gk: pod, namespace: "default", tracks: true, tracksGroupKind: true},
+		{name: "no rules cluster-scoped", gk: namespace, tracks: true, tracksGroupKind: true},
+		{name: "default exclude", exclude: DefaultExclude, gk: secret, namespace: "default"},
+		{name: "default exclude other kind", exclude: DefaultExclude, gk: pod, namespace: "default", tracks: true, tracksGroupKind: true},
+		{name: "included", include: "/Pod", gk: pod, namespace: "default", tracks: true, tracksGroupKind: true},
+		{name: "not included", include: "/Pod", gk: secret, namespace: "default"},
+		{name: "group pattern", include: "*.crossplane.io/*", gk: composition, tracks: true, tracksGroupKind: true},
+		{name: "group pattern other group", include: "*.crossplane.io/*", gk: pod, namespace: "default"},
+		{name: "pattern does not match the core group", include: "*.io/*", gk: pod, namespace: "default"},
+		{name: "kind pattern", include: "/P*", gk: pod, namespace: "default", tracks: true, tracksGroupKind: true},
+		{name: "patterns are case sensitive", include: "/pod", gk: pod, namespace: "default"},
+		{name: "included namespace", include: "/Pod@team-*", gk: pod, namespace: "team-a", tracks: true, tracksGroupKind: true},
+		{name: "other namespace", include: "/Pod@team-*", gk: pod, namespace: "default", tracksGroupKind: true},
+		{name: "namespace rule skips cluster-scoped", include: "/*@default", gk: namespace, tracksGroupKind: true},
+		{name: "excluded namespace", exclude: "/Pod@kube-*", gk: pod, namespace: "kube-system", tracksGroupKind: true},
+		{name: "not excluded namespace", exclude: "/Pod@kube-*", gk: pod, namespace: "default", tracks: true, tracksGroupKind: true},
+		{name: "namespaced exclude keeps cluster-scoped", exclude: "/*@kube-system", gk: namespace, tracks: true, tracksGroupKind: true},
+		{name: "exclude wins over include", include: "/*", exclude: "/Secret", gk: secret, namespace: "default"},
+		{name: "several namespaces", include: "/Pod@a;b", gk: pod, namespace: "b", tracks: true, tracksGroupKind: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rules := mustParseRules(t, test.include, test.exclude)
+			if tracks := rules.Tracks(test.gk, test.namespace); tracks != test.tracks {
+				t.Errorf("got Tracks %t, expected %t", tracks, test.tracks)
+			}
+			if tracks := rules.TracksGroupKind(test.gk); tracks != test.tracksGroupKind {
+				t.Errorf("got TracksGroupKind %t, expected %t", tracks, test.tracksGroupKind)
+			}
+		})
+	}
+}
+
+func TestRulesMerge(t *testing.T) {
+	flags := mustParseRules(t, "/Pod", DefaultExclude)
+	file := mustParseRules(t, "apps/*", "/Pod@kube-system")
+	merged := flags.Merge(file)
+	if len(merged.Include) != 2 || len(merged.Exclude) != len(flags.Exclude)+1 {
+		t.Fatalf("got merged rules %v", merged)
+	}
+	if !merged.Tracks(schema.GroupKind{Group: "apps", Kind: "Deployment"}, "default") {
+		t.Error("expected the kinds included by the file to be tracked")
+	}
+	if merged.Tracks(schema.GroupKind{Kind: "Pod"}, "kube-system") {
+		t.Error("expected the namespaces excluded by the file not to be tracked")
+	}
+	// merging does not modify the merged rules
+	if len(flags.Include) != 1 || len(file.Exclude) != 1 {
+		t.Errorf("merge modified its operands: %v, %v", flags, file)
+	}
+}
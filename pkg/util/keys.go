@@ -6,6 +6,7 @@ import (
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/tools/cache"
 )
 
@@ -13,7 +14,9 @@ import (
 // the group/version/Kind of an object, used to index the listers for all
 // objects, and the namespace/name key for the object. For deleted objects,
 // since they are no longer in the cache, the key stores a shallow copy of the
-// deleted object.
+// deleted object. Keys with no deleted object identify the object only, so that
+// all the events of an object, as well as its deferred updates, are merged into a
+// single item that is processed with the latest state of the object.
 type Key struct {
 	GvkKey           string
 	NamespaceNameKey string
@@ -38,6 +41,19 @@ func KeyForGroupVersionKindNamespaceName(obj any) (Key, error) {
 	return key, nil
 }
 
+// Create a key of type Key for an object identified by its GroupVersionKind, namespace and name,
+// for use when only a reference to the object is available (e.g. in AppliedManifestWork resources)
+func KeyForGroupVersionKindAndObjectRef(gvk schema.GroupVersionKind, namespace, name string) Key {
+	namespaceName := name
+	if namespace != "" {
+		namespaceName = namespace + "/" + name
+	}
+	return Key{
+		GvkKey:           KeyForGroupVersionKind(gvk.Group, gvk.Version, gvk.Kind),
+		NamespaceNameKey: namespaceName,
+	}
+}
+
 // Create a string key in the form group/version/Kind or version/Kind if the group is empty
 func KeyForGroupVersionKind(group, version, kind string) string {
 	if group == "" {
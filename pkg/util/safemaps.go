@@ -38,6 +38,12 @@ func (s *SafeMap) Get(key string) (interface{}, bool) {
 	return v, ok
 }
 
+func (s *SafeMap) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.v)
+}
+
 func (s *SafeMap) ListValues() []interface{} {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -48,6 +54,17 @@ func (s *SafeMap) ListValues() []interface{} {
 	return values
 }
 
+// Snapshot returns a copy of the map
+func (s *SafeMap) Snapshot() map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snapshot := make(map[string]interface{}, len(s.v))
+	for key, value := range s.v {
+		snapshot[key] = value
+	}
+	return snapshot
+}
+
 type SafeUIDMap struct {
 	mu sync.Mutex
 	v  map[string]map[string]bool
@@ -76,6 +93,23 @@ func (s *SafeUIDMap) DeleteUID(key, uid string) {
 	}
 }
 
+func (s *SafeUIDMap) HasUID(key, uid string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.v[key][uid]
+}
+
+// GetUIDCounts returns a snapshot of the number of UIDs for each key
+func (s *SafeUIDMap) GetUIDCounts() map[string]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	counts := make(map[string]int, len(s.v))
+	for key, uids := range s.v {
+		counts[key] = len(uids)
+	}
+	return counts
+}
+
 func (s *SafeUIDMap) GetUIDCount(key string) int {
 	s.mu.Lock()
 	defer s.mu.Unlock()
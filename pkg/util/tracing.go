@@ -0,0 +1,46 @@
+package util
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TraceContext carries the context of the span of the event that put a key onto the work
+// queue, together with the time when the key was enqueued. It is only set for sampled spans.
+type TraceContext struct {
+	TraceID     trace.TraceID
+	SpanID      trace.SpanID
+	TraceFlags  trace.TraceFlags
+	EnqueueTime int64
+}
+
+// NewTraceContext returns the trace context of the span in ctx, or the zero value
+// if there is no sampled span in ctx.
+func NewTraceContext(ctx context.Context) TraceContext {
+	spanContext := trace.SpanContextFromContext(ctx)
+	if !spanContext.IsSampled() {
+		return TraceContext{}
+	}
+	return TraceContext{
+		TraceID:     spanContext.TraceID(),
+		SpanID:      spanContext.SpanID(),
+		TraceFlags:  spanContext.TraceFlags(),
+		EnqueueTime: time.Now().UnixNano(),
+	}
+}
+
+func (t TraceContext) IsValid() bool {
+	return t.TraceID.IsValid() && t.SpanID.IsValid()
+}
+
+// SpanContext returns the span context to use as the remote parent of the spans of the processing of a key
+func (t TraceContext) SpanContext() trace.SpanContext {
+	return trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    t.TraceID,
+		SpanID:     t.SpanID,
+		TraceFlags: t.TraceFlags,
+		Remote:     true,
+	})
+}
@@ -1,6 +1,8 @@
 package util
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"strings"
 
@@ -48,11 +50,37 @@ func GetAddedRemovedInfo(base AppliedManifestInfo, updated AppliedManifestInfo)
 	return added, removed
 }
 
-// BuildWorkstatusName builds a unique work status name from the applied manifest uid and manifestwork name
+// maximum length of the readable part of the name of a WorkStatus
+const maxWorkstatusNamePrefixLength = 200
+
+// BuildWorkstatusName builds a deterministic name for the WorkStatus of an object, made of a readable
+// prefix with the kind, namespace and name of the object followed by a hash of the full identity of
+// the object: the AppliedManifestWork UID, the group, version, kind, namespace and name.
 func BuildWorkstatusName(aw workv1.AppliedManifestWork, obj any) string {
 	mObj := obj.(metav1.Object)
 	rObj := obj.(runtime.Object)
 	gvk := rObj.GetObjectKind().GroupVersionKind()
+
+	parts := []string{gvk.Kind}
+	if mObj.GetNamespace() != "" {
+		parts = append(parts, mObj.GetNamespace())
+	}
+	parts = append(parts, mObj.GetName())
+	prefix := ToNameSegment(strings.Join(parts, "-"))
+	prefix = truncateString(prefix, maxWorkstatusNamePrefixLength)
+	prefix = strings.TrimRight(prefix, "-.")
+
+	identity := strings.Join([]string{string(aw.UID), gvk.Group, gvk.Version, gvk.Kind, mObj.GetNamespace(), mObj.GetName()}, "/")
+	sum := sha256.Sum256([]byte(identity))
+	return prefix + "-" + hex.EncodeToString(sum[:])[:16]
+}
+
+// BuildLegacyWorkstatusName builds the name given to the WorkStatus of an object by previous versions,
+// which may collide for long names. It is only used to migrate the WorkStatuses to the current names.
+func BuildLegacyWorkstatusName(aw workv1.AppliedManifestWork, obj any) string {
+	mObj := obj.(metav1.Object)
+	rObj := obj.(runtime.Object)
+	gvk := rObj.GetObjectKind().GroupVersionKind()
 	name := fmt.Sprintf("%s-%s-%s-%s-%s",
 		aw.UID,
 		strings.ToLower(strings.ReplaceAll(gvk.GroupVersion().String(), "/", "")),
@@ -63,6 +91,21 @@ func BuildWorkstatusName(aw workv1.AppliedManifestWork, obj any) string {
 	return truncateString(name, 253)
 }
 
+// ToNameSegment lowercases a string and replaces the characters not allowed in object names,
+// e.g. the colons in the names of RBAC objects, with dashes
+func ToNameSegment(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-', r == '.':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + ('a' - 'A')
+		default:
+			return '-'
+		}
+	}, s)
+}
+
 func IsListerNotFound(err error) bool {
 	return strings.Contains(err.Error(), "could not get lister for key")
 }
@@ -0,0 +1,112 @@
+package util
+
+import (
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	workv1 "open-cluster-management.io/api/work/v1"
+)
+
+func testObject(apiVersion, kind, namespace, name string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion(apiVersion)
+	obj.SetKind(kind)
+	obj.SetNamespace(namespace)
+	obj.SetName(name)
+	return obj
+}
+
+func TestBuildWorkstatusName(t *testing.T) {
+	aw := workv1.AppliedManifestWork{}
+	aw.UID = types.UID("3f9a8c2e-1b7d-4e5f-9a0b-6c1d2e3f4a5b")
+	longName := strings.Repeat("a", 253)
+	tests := []struct {
+		name     string
+		obj      *unstructured.Unstructured
+		expected string
+	}{
+		{
+			name:     "namespaced",
+			obj:      testObject("apps/v1", "Deployment", "default", "nginx"),
+			expected: "deployment-default-nginx-",
+		},
+		{
+			name:     "cluster-scoped",
+			obj:      testObject("v1", "Namespace", "", "team-a"),
+			expected: "namespace-team-a-",
+		},
+		{
+			name:     "colons",
+			obj:      testObject("rbac.authorization.k8s.io/v1", "ClusterRole", "", "system:controller:job"),
+			expected: "clusterrole-system-controller-job-",
+		},
+		{
+			name:     "very long name",
+			obj:      testObject("v1", "ConfigMap", "default", longName),
+			expected: ("configmap-default-" + longName)[:maxWorkstatusNamePrefixLength] + "-",
+		},
+		{
+			name:     "prefix truncated before a dash",
+			obj:      testObject("v1", "ConfigMap", "default", strings.Repeat("a", 181)+"-b"),
+			expected: "configmap-default-" + strings.Repeat("a", 181) + "-",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			name := BuildWorkstatusName(aw, test.obj)
+			if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+				t.Errorf("name %q is not valid: %v", name, errs)
+			}
+			if !strings.HasPrefix(name, test.expected) || len(name) != len(test.expected)+16 {
+				t.Errorf("got name %q, expected %q followed by a hash of 16 characters", name, test.expected)
+			}
+			if again := BuildWorkstatusName(aw, test.obj.DeepCopy()); again != name {
+				t.Errorf("got name %q for the same object, expected %q", again, name)
+			}
+		})
+	}
+}
+
+func TestBuildWorkstatusNameIdentity(t *testing.T) {
+	aw := workv1.AppliedManifestWork{}
+	aw.UID = types.UID("3f9a8c2e-1b7d-4e5f-9a0b-6c1d2e3f4a5b")
+	otherAW := workv1.AppliedManifestWork{}
+	otherAW.UID = types.UID("0c4b2a1e-7d6f-4e3a-8b9c-5d4e3f2a1b0c")
+	longName := strings.Repeat("a", 253)
+	// objects with the same readable prefix get different names
+	names := map[string]string{}
+	for description, name := range map[string]string{
+		"object":                BuildWorkstatusName(aw, testObject("apps/v1", "Deployment", "default", "nginx")),
+		"other work":            BuildWorkstatusName(otherAW, testObject("apps/v1", "Deployment", "default", "nginx")),
+		"other version":         BuildWorkstatusName(aw, testObject("apps/v1beta1", "Deployment", "default", "nginx")),
+		"other group":           BuildWorkstatusName(aw, testObject("example.com/v1", "Deployment", "default", "nginx")),
+		"dash in the namespace": BuildWorkstatusName(aw, testObject("apps/v1", "Deployment", "default-nginx", "x")),
+		"dash in the name":      BuildWorkstatusName(aw, testObject("apps/v1", "Deployment", "default", "nginx-x")),
+		"long name":             BuildWorkstatusName(aw, testObject("v1", "ConfigMap", "default", longName)),
+		"long name other end":   BuildWorkstatusName(aw, testObject("v1", "ConfigMap", "default", longName[:252]+"b")),
+		"colon in the name":     BuildWorkstatusName(aw, testObject("v1", "ConfigMap", "default", "a:b")),
+		"no colon in the name":  BuildWorkstatusName(aw, testObject("v1", "ConfigMap", "default", "a-b")),
+	} {
+		if other, ok := names[name]; ok {
+			t.Errorf("%s and %s have the same name %q", description, other, name)
+		}
+		names[name] = description
+	}
+}
+
+func TestToNameSegment(t *testing.T) {
+	tests := map[string]string{
+		"Deployment":            "deployment",
+		"system:controller:job": "system-controller-job",
+		"my_name.v1":            "my-name.v1",
+		"été":                   "-t-",
+	}
+	for value, expected := range tests {
+		if got := ToNameSegment(value); got != expected {
+			t.Errorf("got %q for %q, expected %q", got, value, expected)
+		}
+	}
+}
@@ -18,30 +18,102 @@ set -e # exit on error
 
 SCRIPT_HOME=$(dirname $0)
 
+# number of objects created by the load driver, can be raised to measure the memory of the agent
+NUM_OBJECTS=${NUM_OBJECTS:-20}
+# time left to the agent after the load, before its memory is read
+SETTLE_SECONDS=${SETTLE_SECONDS:-30}
+
+CONTROLLER_NAMESPACE=open-cluster-management
+CONTROLLER_DEPLOYMENT=addon-status-controller
+AGENT_NAMESPACE=open-cluster-management-agent-addon
+
+# the settings of the agent informers compared, as "name transforms metadata-only-kinds"
+SETTINGS=(
+  "baseline false -"
+  "transforms true -"
+  "transforms+metadata-only true /Pod"
+)
+
+controller_args=$(kubectl --context kind-hub -n ${CONTROLLER_NAMESPACE} get deploy ${CONTROLLER_DEPLOYMENT} -o jsonpath='{.spec.template.spec.containers[0].args}')
+
+# configure-agent sets the informer settings of the agent through the flags of the controller,
+# which propagates them to the agent, and waits for the agent to restart with them
+function configure-agent() {
+  local transforms=$1
+  local metadata_only=$2
+  [ "$metadata_only" == "-" ] && metadata_only=""
+  local old_pod=$(agent-pod)
+  kubectl --context kind-hub -n ${CONTROLLER_NAMESPACE} patch deploy ${CONTROLLER_DEPLOYMENT} --type=json -p "[
+    {\"op\": \"replace\", \"path\": \"/spec/template/spec/containers/0/args\", \"value\": ${controller_args}},
+    {\"op\": \"add\", \"path\": \"/spec/template/spec/containers/0/args/-\", \"value\": \"--agent-cache-transforms=${transforms}\"},
+    {\"op\": \"add\", \"path\": \"/spec/template/spec/containers/0/args/-\", \"value\": \"--agent-metadata-only-kinds=${metadata_only}\"}]"
+  kubectl --context kind-hub -n ${CONTROLLER_NAMESPACE} rollout status deploy ${CONTROLLER_DEPLOYMENT} --timeout 180s
+  wait-for-cmd "kubectl --context kind-cluster1 -n ${AGENT_NAMESPACE} get deploy status-agent -o jsonpath='{.spec.template.spec.containers[0].args}' | grep -qF -- '\"--cache-transforms=${transforms}\"'"
+  wait-for-cmd "kubectl --context kind-cluster1 -n ${AGENT_NAMESPACE} get deploy status-agent -o jsonpath='{.spec.template.spec.containers[0].args}' | grep -qF -- '\"--metadata-only-kinds=${metadata_only}\"'"
+  kubectl --context kind-cluster1 -n ${AGENT_NAMESPACE} rollout status deploy status-agent --timeout 180s
+  if [ -n "$old_pod" ]; then
+    kubectl --context kind-cluster1 -n ${AGENT_NAMESPACE} wait pod "$old_pod" --for delete --timeout 180s
+  fi
+}
+
+function agent-pod() {
+  kubectl --context kind-cluster1 -n ${AGENT_NAMESPACE} get pods -l app=status-agent --no-headers -o custom-columns=":metadata.name" | head -1
+}
+
+# agent-memory prints the heap in use and the resident memory of the agent, in bytes
+function agent-memory() {
+  local metrics=$(kubectl --context kind-cluster1 get --raw "/api/v1/namespaces/${AGENT_NAMESPACE}/pods/$(agent-pod):8080/proxy/metrics")
+  local heap=$(echo "$metrics" | awk '$1 == "go_memstats_heap_inuse_bytes" {printf "%d", $2}')
+  local rss=$(echo "$metrics" | awk '$1 == "process_resident_memory_bytes" {printf "%d", $2}')
+  echo "$heap $rss"
+}
+
+# run-load deletes all manifestworks except the add-on deployment, runs the load driver and
+# waits for the expected number of work status objects in the ITS
+function run-load() {
+  manifests=$(kubectl --context kind-hub -n cluster1 get manifestworks --no-headers -o custom-columns=":metadata.name")
+  for manifest in $manifests; do
+    if [ "$manifest" != "addon-addon-status-deploy-0" ]; then
+      kubectl --context kind-hub -n cluster1 delete manifestwork "$manifest"
+    fi
+  done
+  wait-for-cmd '(($(kubectl --context kind-hub -n cluster1 get workstatus --no-headers 2>/dev/null | wc -l) == 0))'
+
+  kubectl config use-context kind-hub
+  go run ${SCRIPT_HOME}/load-driver.go --num-objects ${NUM_OBJECTS}
+
+  wait-for-cmd "((\$(kubectl --context kind-hub -n cluster1 get workstatus --no-headers 2>/dev/null | wc -l) == ${NUM_OBJECTS}))"
+}
+
 :
 : -------------------------------------------------------------------------
-: Delete all manifestworks except the add-on deployment
+: Run the load with each setting of the agent informers and read the memory of the agent
 :
-manifests=$(kubectl --context kind-hub -n cluster1 get manifestworks --no-headers -o custom-columns=":metadata.name")
-for manifest in $manifests; do
-  if [ "$manifest" != "addon-addon-status-deploy-0" ]; then
-    kubectl --context kind-hub -n cluster1 delete manifestwork "$manifest"
-  fi
+results=()
+for setting in "${SETTINGS[@]}"; do
+  read -r name transforms metadata_only <<< "$setting"
+  configure-agent "$transforms" "$metadata_only"
+  run-load
+  sleep ${SETTLE_SECONDS}
+  results+=("$name $(agent-memory)")
 done
 
 :
 : -------------------------------------------------------------------------
-: Run the load driver
+: Restore the flags of the controller
 :
-kubectl config use-context kind-hub
-go run ${SCRIPT_HOME}/load-driver.go --num-objects 20
-
+kubectl --context kind-hub -n ${CONTROLLER_NAMESPACE} patch deploy ${CONTROLLER_DEPLOYMENT} --type=json -p "[
+  {\"op\": \"replace\", \"path\": \"/spec/template/spec/containers/0/args\", \"value\": ${controller_args}}]"
+kubectl --context kind-hub -n ${CONTROLLER_NAMESPACE} rollout status deploy ${CONTROLLER_DEPLOYMENT} --timeout 180s
 
 :
 : -------------------------------------------------------------------------
-: Verify that the expected number of work status objects has been created in the ITS
+: Memory of the agent with ${NUM_OBJECTS} objects, relative to the baseline
 :
-wait-for-cmd '(($(kubectl --context kind-hub -n cluster1 get workstatus --no-headers 2>/dev/null | wc -l) == 20))'
+printf "%s\n" "${results[@]}" | awk '
+  NR == 1 { base_heap = $2; base_rss = $3
+            printf "%-26s %10s %7s %10s %7s\n", "SETTING", "HEAP_MIB", "HEAP_%", "RSS_MIB", "RSS_%" }
+  { printf "%-26s %10.1f %6.0f%% %10.1f %6.0f%%\n", $1, $2 / 1048576, 100 * $2 / base_heap, $3 / 1048576, 100 * $3 / base_rss }'
 
 :
 : -------------------------------------------------------------------------